@@ -0,0 +1,219 @@
+package cmdparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// aliasDefinition matches the alias and unalias commands of HandleDefinition
+var aliasDefinition = regexp.MustCompile(`^\s*(alias|unalias)\s+([A-Za-z_][A-Za-z0-9_]*)\s*(=\s*(.*?))?\s*$`)
+
+// aliasName matches a valid alias name
+var aliasName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// NewAliasTable creates an alias table. If store is not nil, the aliases are
+// loaded from it and every change is saved to it.
+func NewAliasTable(store AliasStore) (*AliasTable, error) {
+	table := &AliasTable{aliases: map[string]string{}, store: store}
+	if store != nil {
+		aliases, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for name, body := range aliases {
+			table.aliases[name] = body
+		}
+	}
+	return table, nil
+}
+
+// Define adds or replaces an alias. In the body $1, $2, ... are replaced by
+// the arguments following the alias, $* by all arguments. Arguments that are
+// not referenced are appended to the expansion.
+func (table *AliasTable) Define(name, body string) error {
+	if !aliasName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidAliasName, name)
+	}
+	table.aliases[name] = strings.TrimSpace(body)
+	return table.save()
+}
+
+// Remove deletes an alias
+func (table *AliasTable) Remove(name string) error {
+	delete(table.aliases, name)
+	return table.save()
+}
+
+// Lookup returns the body of an alias
+func (table *AliasTable) Lookup(name string) (string, bool) {
+	body, ok := table.aliases[name]
+	return body, ok
+}
+
+// Names returns the sorted names of all aliases
+func (table *AliasTable) Names() []string {
+	result := []string{}
+	for name := range table.aliases {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// HandleDefinition processes the input lines `alias name = body` and `unalias name`.
+// It returns false for all other lines, so they can be passed to the parser.
+func (table *AliasTable) HandleDefinition(line string) (bool, error) {
+	m := aliasDefinition.FindStringSubmatch(line)
+	if m == nil || (m[1] == "alias") != (m[3] != "") {
+		return false, nil
+	}
+	if m[1] == "unalias" {
+		return true, table.Remove(m[2])
+	}
+	return true, table.Define(m[2], m[4])
+}
+
+func (table *AliasTable) save() error {
+	if table.store == nil {
+		return nil
+	}
+	return table.store.Save(table.aliases)
+}
+
+// Load to implement the AliasStore interface for the FileAliasStore.
+// A missing file is an empty alias list.
+func (store *FileAliasStore) Load() (map[string]string, error) {
+	result := map[string]string{}
+	f, err := os.Open(store.Path)
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == COMMENTCHAR {
+			continue
+		}
+		m := aliasDefinition.FindStringSubmatch("alias " + line)
+		if m == nil || m[3] == "" {
+			return nil, errors.New(store.Path + ": invalid alias definition " + line)
+		}
+		result[m[2]] = m[4]
+	}
+	return result, scanner.Err()
+}
+
+// Save to implement the AliasStore interface for the FileAliasStore
+func (store *FileAliasStore) Save(aliases map[string]string) error {
+	names := []string{}
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + " = " + aliases[name] + "\n")
+	}
+	return os.WriteFile(store.Path, []byte(sb.String()), 0644)
+}
+
+// SetAliases activates alias expansion for the input of the parser
+func (theParser *CommandParser) SetAliases(table *AliasTable) {
+	theParser.aliases = table
+}
+
+// expandAliases expands the aliases at the start of every statement
+func (theParser *CommandParser) expandAliases(tokens []*CmdToken) ([]*CmdToken, error) {
+	if theParser.aliases == nil {
+		return tokens, nil
+	}
+	result := []*CmdToken{}
+	index := 0
+	for _, statement := range splitTokens(tokens, STATEMENTSEPARATOR) {
+		expanded, err := theParser.expandStatement(statement, map[string]bool{}, "")
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+		index += len(statement)
+		if index < len(tokens) {
+			// keep the separator of the statements
+			result = append(result, tokens[index])
+			index++
+		}
+	}
+	return result, nil
+}
+
+// expandStatement replaces the alias at the start of a statement by its body.
+// The tokens of the body get the position of the alias in the input, so errors
+// point to the alias. The result is expanded again until no alias is left, an
+// alias that starts with its own name, like `show = show feature`, is not
+// expanded again.
+func (theParser *CommandParser) expandStatement(tokens []*CmdToken, seen map[string]bool, lastAlias string) ([]*CmdToken, error) {
+	if len(tokens) == 0 || tokens[0].Type != TokenIdent {
+		return tokens, nil
+	}
+	aliasTok := tokens[0]
+	body, ok := theParser.aliases.Lookup(aliasTok.Text)
+	if !ok {
+		return tokens, nil
+	}
+	if seen[aliasTok.Text] {
+		if aliasTok.Text == lastAlias {
+			return tokens, nil
+		}
+		return nil, &TokenError{Position: aliasTok.Position, Text: aliasTok.Text, Err: ErrAliasRecursion}
+	}
+	seen[aliasTok.Text] = true
+	bodyTokens, err := theParser.tokenizer.Tokenize(body)
+	if err == nil {
+		bodyTokens, err = theParser.interpolate(body, bodyTokens)
+	}
+	if err != nil {
+		return nil, &TokenError{Position: aliasTok.Position, Text: aliasTok.Text, Err: err}
+	}
+
+	args := tokens[1:]
+	used := 0
+	result := []*CmdToken{}
+	for i := 0; i < len(bodyTokens); i++ {
+		tok := bodyTokens[i]
+		if tok.Type == TokenChar && tok.Text == "$" && i+1 < len(bodyTokens) && adjacent(tok, bodyTokens[i+1]) {
+			next := bodyTokens[i+1]
+			if next.Type == TokenInt {
+				n := next.Value.(int)
+				if n < 1 || n > len(args) {
+					return nil, &TokenError{Position: aliasTok.Position, Text: aliasTok.Text + " $" + next.Text, Err: ErrMissingAliasArgument}
+				}
+				// an argument may be used more than once, so each use is a copy
+				result = append(result, copyToken(args[n-1]))
+				if n > used {
+					used = n
+				}
+				i++
+				continue
+			} else if next.Type == TokenChar && next.Text == "*" {
+				for _, arg := range args {
+					result = append(result, copyToken(arg))
+				}
+				used = len(args)
+				i++
+				continue
+			}
+		}
+		tok.Position = aliasTok.Position
+		tok.End = aliasTok.End
+		result = append(result, tok)
+	}
+	result = append(result, args[used:]...)
+	return theParser.expandStatement(result, seen, aliasTok.Text)
+}
@@ -0,0 +1,90 @@
+package cmdparser
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var aliasGrammar = map[string]string{
+	"START":         `"show"  FeatureClause  Options  ToClause? `,
+	"ToClause":      `"to"  !string `,
+	"FeatureClause": `"feature"  !string? `,
+	"Options":       `TranClause | DefClause `,
+	"TranClause":    `"translation"  LangList? `,
+	"LangList":      `"lang"  !string `,
+	"DefClause":     `"definition" `,
+}
+
+func TestAliases(t *testing.T) {
+	table, _ := NewAliasTable(nil)
+	handled, err := table.HandleDefinition(`alias sf = show feature $1 translation`)
+	Assert(t, handled && err == nil, "Alias definition not handled")
+	handled, _ = table.HandleDefinition(`show feature "x" definition`)
+	Assert(t, !handled, "Only alias definitions are handled")
+	table.Define("sfd", `sf "de" lang "de"`)
+	for _, name := range []string{"sf = x", "two words", "", "1st"} {
+		Assert(t, errors.Is(table.Define(name, `show`), ErrInvalidAliasName), "Expected an invalid alias name "+name)
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(aliasGrammar)
+	p.SetAliases(table)
+
+	p.SetInputString(`sf "it" to "/tmp/it.csv"`)
+	Assert(t, p.Parse(), "Should match expanded alias, but does not!")
+	Assert(t, p.ParseResult["featureclause_string"].Value == "it", "Alias argument not substituted")
+	Assert(t, p.ParseResult["toclause_string"].Position.Column == 12, "Arguments must keep their position")
+
+	p.SetInputString(`sfd ; show "fr" definition`)
+	Assert(t, len(p.tokenList) == 10, "Expected both statements to be expanded")
+	Assert(t, p.tokenList[0].Position.Column == 1 && p.tokenList[3].Position.Column == 1, "Alias tokens must point to the alias")
+
+	table.Define("show", `show feature`)
+	p.SetInputString(`show "fr" definition`)
+	Assert(t, p.Parse(), "Alias starting with its own name should match")
+
+	table.Define("loop1", `loop2 "x"`)
+	table.Define("loop2", `loop1`)
+	err = p.SetInputString(`  loop1`)
+	var tokErr *TokenError
+	Assert(t, errors.As(err, &tokErr) && errors.Is(err, ErrAliasRecursion), "Expected recursion error")
+	Assert(t, tokErr != nil && tokErr.Position.Column == 3, "Recursion error must point to the input")
+	err = p.SetInputString(`sf`)
+	Assert(t, errors.Is(err, ErrMissingAliasArgument), "Expected missing argument error")
+}
+
+func TestAliasArgumentCopies(t *testing.T) {
+	table, _ := NewAliasTable(nil)
+	table.Define("twice", `copy $1 $1`)
+	table.Define("all", `copy $* $*`)
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"copy" !string !string`})
+	p.SetAliases(table)
+
+	p.SetInputString(`twice "a"`)
+	Assert(t, p.Parse(), "Expected the argument twice")
+	Assert(t, p.tokenList[1] != p.tokenList[2], "Expected each use of an argument to be a copy")
+
+	results, err := p.ParseScript(strings.NewReader("# copies\n\ntwice \"a\"\nall \"b\"\n"))
+	Assert(t, err == nil && len(results) == 2, "Expected 2 statements")
+	for _, result := range results {
+		Assert(t, result.ParseResult["start_string"].Position.Line == result.Line, "Expected the arguments on the line of the statement")
+	}
+}
+
+func TestAliasStore(t *testing.T) {
+	store := &FileAliasStore{Path: filepath.Join(t.TempDir(), "aliases")}
+	table, err := NewAliasTable(store)
+	Assert(t, err == nil, "Missing alias file is not an error")
+	table.HandleDefinition(`alias sf = show feature $1 translation`)
+	table.HandleDefinition(`alias sd = show feature definition`)
+	table.HandleDefinition(`unalias sd`)
+
+	loaded, err := NewAliasTable(store)
+	Assert(t, err == nil, "Unexpected error loading aliases")
+	body, ok := loaded.Lookup("sf")
+	Assert(t, ok && body == "show feature $1 translation", "Alias not persisted")
+	Assert(t, len(loaded.Names()) == 1, "Removed alias must not be persisted")
+}
@@ -0,0 +1,201 @@
+package cmdparser
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// deepGrammar nests depth rules, each rule refers to the next one
+func deepGrammar(depth int) map[string]string {
+	grammar := map[string]string{"START": `"go" Level1`}
+	for i := 1; i < depth; i++ {
+		grammar["Level"+strconv.Itoa(i)] = `"down"? Level` + strconv.Itoa(i+1)
+	}
+	grammar["Level"+strconv.Itoa(depth)] = `!int`
+	return grammar
+}
+
+// wideGrammar has a choice of width commands, the input matches the last one
+func wideGrammar(width int) map[string]string {
+	grammar := map[string]string{}
+	choices := []string{}
+	for i := 0; i < width; i++ {
+		name := "Cmd" + strconv.Itoa(i)
+		grammar[name] = `"cmd` + strconv.Itoa(i) + `" !int?`
+		choices = append(choices, name)
+	}
+	grammar["START"] = strings.Join(choices, " | ")
+	return grammar
+}
+
+// longInput is a statement with n values separated by sep
+func longInput(n int, sep string) string {
+	values := []string{}
+	for i := 0; i < n; i++ {
+		values = append(values, strconv.Itoa(i))
+	}
+	return "values " + strings.Join(values, sep)
+}
+
+func TestCommandFixture(t *testing.T) {
+	Assert(t, len(commandInputs) == 50, "Expected an input for each of the 50 commands")
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	for _, input := range commandInputs {
+		p.SetInputString(input)
+		if !p.Parse() {
+			t.Error("Expected a match for " + input)
+		}
+	}
+}
+
+// TestAllocationBudget catches changes that make parsing allocate a lot more
+func TestAllocationBudget(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	line := commandInputs[30]
+	budgets := []struct {
+		name   string
+		budget float64
+		fn     func()
+	}{
+		{"tokenize", 150, func() { p.SetInputString(line) }},
+		{"parse", 400, func() { p.SetInputString(line); p.Parse() }},
+		{"results", 80, func() { p.buildParseResults() }},
+	}
+	for _, b := range budgets {
+		allocs := testing.AllocsPerRun(20, b.fn)
+		if allocs > b.budget {
+			t.Errorf("%s: %.0f allocations, the budget is %.0f", b.name, allocs, b.budget)
+		}
+	}
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		line := longInput(n, " ")
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			p := NewParser()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p.SetInputString(line)
+			}
+		})
+	}
+}
+
+func BenchmarkCompileGrammar(b *testing.B) {
+	grammars := map[string]map[string]string{
+		"commands": commandGrammar,
+		"deep":     deepGrammar(50),
+		"wide":     wideGrammar(200),
+	}
+	for name, grammar := range grammars {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				NewParser().SetCommandGrammar(grammar)
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	cases := []struct {
+		name    string
+		grammar map[string]string
+		input   string
+	}{
+		{"small", map[string]string{"START": `"show" "feature" !string?`}, `show feature "de"`},
+		{"commands", commandGrammar, commandInputs[30]},
+		{"deep", deepGrammar(50), "go down down 42"},
+		{"wide", wideGrammar(200), "cmd199 42"},
+		{"long", map[string]string{"START": `"values" !int*`}, longInput(1000, " ")},
+		{"list", map[string]string{"START": `"values" !int % ','`}, longInput(1000, ", ")},
+	}
+	for _, c := range cases {
+		for _, memo := range []bool{false, true} {
+			name := c.name
+			if memo {
+				name += "/memo"
+			}
+			b.Run(name, func(b *testing.B) {
+				p := NewParser()
+				p.SetCommandGrammar(c.grammar)
+				if memo {
+					p.SetOptions(OptionMemoize)
+				}
+				p.SetInputString(c.input)
+				if !p.Parse() {
+					b.Fatal("no match for " + c.input)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.Parse()
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCommands(b *testing.B) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, input := range commandInputs {
+			p.SetInputString(input)
+			p.Parse()
+		}
+	}
+}
+
+func BenchmarkBuildParseResults(b *testing.B) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	p.SetInputString(commandInputs[30])
+	p.Parse()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.ParseResult = map[string]CmdToken{}
+		p.buildParseResults()
+	}
+}
+
+// BenchmarkLongStatement grows a single statement, the time per token stays
+// the same for long inputs with and without memoization
+func BenchmarkLongStatement(b *testing.B) {
+	grammar := map[string]string{
+		"START": `"values" Value*`,
+		"Value": `!int "to" !int | !int`,
+	}
+	for _, n := range []int{10, 100, 1000, 10000} {
+		line := longInput(n, " ")
+		for _, memo := range []bool{false, true} {
+			name := strconv.Itoa(n)
+			if memo {
+				name += "/memo"
+			}
+			b.Run(name, func(b *testing.B) {
+				p := NewParser()
+				p.SetCommandGrammar(grammar)
+				if memo {
+					p.SetOptions(OptionMemoize)
+				}
+				p.SetInputString(line)
+				if !p.Parse() {
+					b.Fatal("no match for a statement of " + strconv.Itoa(n) + " values")
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					p.Parse()
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*(n+1)), "ns/token")
+			})
+		}
+	}
+}
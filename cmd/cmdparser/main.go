@@ -0,0 +1,428 @@
+// Command cmdparser helps to develop grammars for the cmdparser package.
+//
+// Usage:
+//
+//	cmdparser check GRAMMARFILE...     compile and lint the grammars
+//	cmdparser lint GRAMMARFILE...      print the issues found by Lint
+//	cmdparser parse GRAMMARFILE INPUT  print tokens, tree and results as JSON
+//	cmdparser trace GRAMMARFILE INPUT  print the steps of the match, -json as JSON lines,
+//	                                   -tree as a tree, -html as a HTML report
+//	cmdparser test GRAMMARFILE TESTFILE...
+//	                                   run the cases of the test files, -update writes
+//	                                   the results, see package cmdparsertest
+//	cmdparser cover GRAMMARFILE TESTFILE...
+//	                                   print which rules and items the inputs of the
+//	                                   test files cover, -json as JSON, -html as HTML
+//	cmdparser usage GRAMMARFILE        print the synopsis of the grammar
+//	cmdparser repl GRAMMARFILE         parse the lines read from stdin
+//
+// The grammar file has one `Name: expression` rule per line, see ReadGrammar.
+// The words of INPUT are joined by blanks and parsed like an input line. The
+// flags come before GRAMMARFILE, a word like -json after it is an error unless
+// it follows "--", as in `cmdparser parse shell.grammar -- ls -json`.
+// check, lint, parse, trace and test exit with status 1 if there are issues,
+// no match or failed cases.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/derlinkshaender/cmdparser"
+	"github.com/derlinkshaender/cmdparser/cmdparsertest"
+)
+
+const usage = `usage: cmdparser COMMAND [-json|-tree|-html|-update] GRAMMARFILE [INPUT]
+
+The flags come before GRAMMARFILE, after GRAMMARFILE -- ends them.
+
+commands:
+  check GRAMMARFILE...     compile and lint the grammars
+  lint GRAMMARFILE...      print the issues found by Lint
+  parse GRAMMARFILE INPUT  print tokens, tree and results as JSON
+  trace GRAMMARFILE INPUT  print the steps of the match, -json as JSON lines,
+                           -tree as a tree, -html as a HTML report
+  test GRAMMARFILE TESTFILE...
+                           run the cases of the test files, -update writes the results
+  cover GRAMMARFILE TESTFILE...
+                           print the coverage of the grammar by the test files,
+                           -json as JSON, -html as a HTML report
+  usage GRAMMARFILE        print the synopsis of the grammar
+  repl GRAMMARFILE         parse the lines read from stdin`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	command := args[0]
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	jsonOutput := flags.Bool("json", false, "write the trace as JSON lines, the coverage as JSON")
+	treeTrace := flags.Bool("tree", false, "write the trace and the parse tree as trees")
+	htmlOutput := flags.Bool("html", false, "write the trace or the coverage as a HTML page")
+	update := flags.Bool("update", false, "write the results to the test files")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() < 1 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	positional, err := positionalArgs(flags)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	file, rest := positional[0], positional[1:]
+	switch command {
+	case "check", "lint":
+		return check(positional, command == "check", stdout, stderr)
+	}
+	p, err := loadGrammar(file)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	switch command {
+	case "parse":
+		return parse(p, strings.Join(rest, " "), stdout, stderr)
+	case "trace":
+		if *treeTrace || *htmlOutput {
+			return writeReport(p, strings.Join(rest, " "), *htmlOutput, stdout, stderr)
+		}
+		tracer := cmdparser.NewTextTracer(stdout)
+		if *jsonOutput {
+			tracer = cmdparser.NewJSONTracer(stdout)
+		}
+		return trace(p, tracer, strings.Join(rest, " "), stdout, stderr)
+	case "test":
+		return test(p, rest, *update, stdout, stderr)
+	case "cover":
+		return cover(p, rest, *jsonOutput, *htmlOutput, stdout, stderr)
+	case "usage":
+		for _, line := range p.Synopsis() {
+			fmt.Fprintln(stdout, line)
+		}
+		return 0
+	case "repl":
+		return repl(p, stdin, stdout)
+	}
+	fmt.Fprintln(stderr, "unknown command "+command)
+	fmt.Fprintln(stderr, usage)
+	return 2
+}
+
+// positionalArgs returns the arguments after the flags. A flag of the command
+// after GRAMMARFILE is an error, it would be read as input. The arguments after
+// "--" are input, even if they look like flags.
+func positionalArgs(flags *flag.FlagSet) ([]string, error) {
+	result := []string{}
+	for i, arg := range flags.Args() {
+		if arg == "--" && i > 0 {
+			return append(result, flags.Args()[i+1:]...), nil
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if strings.HasPrefix(arg, "-") && flags.Lookup(name) != nil {
+			return nil, errors.New("flag " + arg + " must come before GRAMMARFILE")
+		}
+		result = append(result, arg)
+	}
+	return result, nil
+}
+
+// loadGrammar reads a grammar file and compiles it, an invalid rule is an error
+func loadGrammar(file string) (*cmdparser.CommandParser, error) {
+	grammar, err := cmdparser.ReadGrammarFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p := cmdparser.NewParser()
+	if err := p.CompileGrammar(grammar); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return p, nil
+}
+
+// check prints the issues of each grammar file, with verbose a grammar without
+// issues is reported as ok
+func check(files []string, verbose bool, stdout, stderr io.Writer) int {
+	status := 0
+	for _, file := range files {
+		p, err := loadGrammar(file)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 2
+			continue
+		}
+		issues := p.Lint()
+		for _, issue := range issues {
+			fmt.Fprintln(stdout, file+": "+issue.String())
+			if status == 0 {
+				status = 1
+			}
+		}
+		if len(issues) == 0 && verbose {
+			fmt.Fprintln(stdout, file+": ok")
+		}
+	}
+	return status
+}
+
+// jsonToken is a token in the JSON output of parse
+type jsonToken struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text"`
+	Value  interface{} `json:"value"`
+	Line   int         `json:"line"`
+	Column int         `json:"column"`
+}
+
+// jsonNode is a node of the parse tree in the JSON output of parse
+type jsonNode struct {
+	Name     string      `json:"name"`
+	Key      string      `json:"key,omitempty"`
+	Token    *jsonToken  `json:"token,omitempty"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+// jsonError is a parse error in the JSON output of parse
+type jsonError struct {
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// parseOutput is the JSON output of parse
+type parseOutput struct {
+	Input   string               `json:"input"`
+	Match   bool                 `json:"match"`
+	Error   string               `json:"error,omitempty"`
+	Tokens  []*jsonToken         `json:"tokens"`
+	Tree    *jsonNode            `json:"tree,omitempty"`
+	Results map[string]jsonToken `json:"results"`
+	Errors  []jsonError          `json:"errors,omitempty"`
+}
+
+// tokenTypes are the names of the token types in the JSON output
+var tokenTypes = map[cmdparser.TokenType]string{
+	cmdparser.TokenEOF:    "eof",
+	cmdparser.TokenIdent:  "ident",
+	cmdparser.TokenChar:   "char",
+	cmdparser.TokenString: "string",
+	cmdparser.TokenInt:    "int",
+	cmdparser.TokenFloat:  "float",
+	cmdparser.TokenBool:   "bool",
+	cmdparser.TokenExpr:   "expression",
+	cmdparser.TokenFlag:   "flag",
+	cmdparser.TokenList:   "list",
+	cmdparser.TokenERR:    "error",
+}
+
+// newJSONToken converts a token for the JSON output, the values of lists and
+// flags are tokens, too
+func newJSONToken(tok *cmdparser.CmdToken) *jsonToken {
+	result := &jsonToken{Type: tokenTypes[tok.Type], Text: tok.Text, Value: tok.Value, Line: tok.Position.Line, Column: tok.Position.Column}
+	switch value := tok.Value.(type) {
+	case []cmdparser.CmdToken:
+		list := []*jsonToken{}
+		for i := range value {
+			list = append(list, newJSONToken(&value[i]))
+		}
+		result.Value = list
+	case *cmdparser.CmdToken:
+		result.Value = newJSONToken(value)
+	}
+	return result
+}
+
+// newJSONNode converts a node of the parse tree for the JSON output
+func newJSONNode(node *cmdparser.ParseNode) *jsonNode {
+	result := &jsonNode{Name: node.Name, Key: node.Key}
+	if node.Token != nil {
+		result.Token = newJSONToken(node.Token)
+	}
+	for _, child := range node.Children {
+		result.Children = append(result.Children, newJSONNode(child))
+	}
+	return result
+}
+
+// parse prints the tokens, the parse tree and the results of the input as JSON
+func parse(p *cmdparser.CommandParser, input string, stdout, stderr io.Writer) int {
+	output := parseOutput{Input: input, Tokens: []*jsonToken{}, Results: map[string]jsonToken{}}
+	if err := p.SetInputString(input); err != nil {
+		output.Error = err.Error()
+	} else {
+		output.Match = p.Parse()
+	}
+	for _, tok := range p.Tokens() {
+		output.Tokens = append(output.Tokens, newJSONToken(tok))
+	}
+	if tree := p.ParseTree(); tree != nil {
+		output.Tree = newJSONNode(tree)
+	}
+	for key, tok := range p.ParseResult {
+		output.Results[key] = *newJSONToken(&tok)
+	}
+	for _, e := range p.Errors() {
+		output.Errors = append(output.Errors, jsonError{Column: e.Column, Message: e.Message})
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(output); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if !output.Match {
+		return 1
+	}
+	return 0
+}
+
+// trace sends the steps of the parser to the tracer while it matches the input
+func trace(p *cmdparser.CommandParser, tracer cmdparser.Tracer, input string, stdout, stderr io.Writer) int {
+	if err := p.SetInputString(input); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	p.SetTracer(tracer)
+	match := p.Parse()
+	p.SetTracer(nil)
+	if !match {
+		return 1
+	}
+	return 0
+}
+
+// writeReport writes the steps of the match and the parse tree as trees or as a
+// HTML page, the trees are colored if stdout is a terminal
+func writeReport(p *cmdparser.CommandParser, input string, html bool, stdout, stderr io.Writer) int {
+	report, err := p.TraceInput(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if html {
+		err = report.WriteHTML(stdout)
+	} else {
+		err = report.WriteText(stdout, isTerminal(stdout))
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if !report.Match {
+		return 1
+	}
+	return 0
+}
+
+// isTerminal tells if the output goes to a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// test runs the cases of the test files and prints the failed ones
+func test(p *cmdparser.CommandParser, files []string, update bool, stdout, stderr io.Writer) int {
+	status := 0
+	for _, file := range files {
+		failures, err := cmdparsertest.RunFile(p, file, update)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 2
+			continue
+		}
+		for _, failure := range failures {
+			fmt.Fprintln(stdout, failure.String())
+			if status == 0 {
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// cover parses the inputs of the test files and prints the coverage of the grammar
+func cover(p *cmdparser.CommandParser, files []string, jsonOutput, htmlOutput bool, stdout, stderr io.Writer) int {
+	coverage := cmdparser.NewCoverage(p)
+	p.SetTracer(coverage)
+	defer p.SetTracer(nil)
+	for _, file := range files {
+		tests, err := cmdparsertest.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		for _, c := range tests.Cases {
+			cmdparsertest.Parse(p, c.Input)
+		}
+	}
+	var err error
+	switch {
+	case jsonOutput:
+		err = coverage.WriteJSON(stdout)
+	case htmlOutput:
+		err = coverage.WriteHTML(stdout)
+	default:
+		err = coverage.WriteText(stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
+
+// repl parses each line read from in and prints the results or the errors
+func repl(p *cmdparser.CommandParser, in io.Reader, stdout io.Writer) int {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(stdout, "> ")
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			printResult(p, line, stdout)
+		}
+		fmt.Fprint(stdout, "> ")
+	}
+	fmt.Fprintln(stdout)
+	return 0
+}
+
+// printResult parses an input line and prints the results sorted by key
+func printResult(p *cmdparser.CommandParser, line string, stdout io.Writer) {
+	if err := p.SetInputString(line); err != nil {
+		fmt.Fprintln(stdout, "error:", err)
+		return
+	}
+	if !p.Parse() {
+		fmt.Fprintln(stdout, "no match")
+		for _, e := range p.Errors() {
+			fmt.Fprintf(stdout, "  col %d: %s\n", e.Column, e.Message)
+		}
+		return
+	}
+	fmt.Fprintln(stdout, "match")
+	keys := []string{}
+	for key := range p.ParseResult {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(stdout, "  %s = %v\n", key, p.ParseResult[key].Text)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testGrammar = `# the grammar of the tests
+START: "show" Target ToClause?
+Target: "users" | "groups" !ident
+ToClause: "to" !string
+`
+
+// writeGrammar writes a grammar file and returns its path
+func writeGrammar(t *testing.T, grammar string) string {
+	path := filepath.Join(t.TempDir(), "test.grammar")
+	if err := os.WriteFile(path, []byte(grammar), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runCommand runs the command and returns its exit status and output
+func runCommand(args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestCheck(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	status, out, _ := runCommand([]string{"check", path}, "")
+	if status != 0 || out != path+": ok\n" {
+		t.Errorf("Expected the grammar to be ok, got %d %q", status, out)
+	}
+
+	path = writeGrammar(t, "START: !ident | \"all\"\n")
+	status, out, _ = runCommand([]string{"lint", path}, "")
+	if status != 1 || !strings.Contains(out, "[shadowed]") {
+		t.Errorf("Expected a shadowed alternative, got %d %q", status, out)
+	}
+
+	path = writeGrammar(t, "START: 'ab'\n")
+	status, _, errOut := runCommand([]string{"check", path}, "")
+	if status != 2 || errOut != path+": INVALID_GRAMMAR_ITEM ['ab'] in rule START\n" {
+		t.Errorf("Expected an invalid grammar, got %d %q", status, errOut)
+	}
+}
+
+func TestParse(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	status, out, _ := runCommand([]string{"parse", path, "show", "groups", "admins", `to "/tmp/x"`}, "")
+	if status != 0 {
+		t.Fatalf("Expected a match, got %d %s", status, out)
+	}
+	var output parseOutput
+	if err := json.Unmarshal([]byte(out), &output); err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Tokens) != 5 || output.Tokens[4].Type != "string" {
+		t.Errorf("Expected 5 tokens, got %v", output.Tokens)
+	}
+	if output.Results["target.2_ident"].Text != "admins" {
+		t.Errorf("Expected the ident in the results, got %v", output.Results)
+	}
+	if len(output.Tree.Children) != 3 || output.Tree.Children[1].Name != "Target" || output.Tree.Children[2].Children[1].Key != "toclause_string" {
+		t.Errorf("Unexpected tree %s", out)
+	}
+
+	status, out, _ = runCommand([]string{"parse", path, "show", "all"}, "")
+	if status != 1 || !strings.Contains(out, `"match": false`) {
+		t.Errorf("Expected no match, got %d %s", status, out)
+	}
+}
+
+func TestUsageAndRepl(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	_, out, _ := runCommand([]string{"usage", path}, "")
+	if out != "show (users | groups IDENT) [to STRING]\n" {
+		t.Errorf("Unexpected synopsis %q", out)
+	}
+
+	_, out, _ = runCommand([]string{"repl", path}, "show users\nshow\n")
+	if !strings.Contains(out, "match\n  start_show = show\n") || !strings.Contains(out, "no match\n") {
+		t.Errorf("Unexpected repl output %q", out)
+	}
+}
+
+func TestInvalidGrammar(t *testing.T) {
+	path := writeGrammar(t, "START: \"show\" Missing\n")
+	status, _, errOut := runCommand([]string{"parse", path, "show", "foo"}, "")
+	if status != 2 || errOut != path+": MISSING_RULE [Missing] in rule START\n" {
+		t.Errorf("Expected an undefined rule, got %d %q", status, errOut)
+	}
+
+	path = writeGrammar(t, "Cmd: \"show\"\n")
+	status, _, errOut = runCommand([]string{"repl", path}, "show\n")
+	if status != 2 || errOut != path+": MISSING_RULE START\n" {
+		t.Errorf("Expected a missing START rule, got %d %q", status, errOut)
+	}
+
+	path = writeGrammar(t, "START: \"show\" !integer\n")
+	status, _, errOut = runCommand([]string{"parse", path, "show", "1"}, "")
+	if status != 2 || errOut != path+": INVALID_GRAMMAR_ITEM [!integer] in rule START\n" {
+		t.Errorf("Expected an unknown type, got %d %q", status, errOut)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	status, out, _ := runCommand([]string{"trace", path, "show", "users"}, "")
+	if status != 0 || !strings.HasPrefix(out, "START at show at 1:1\n") || !strings.HasSuffix(out, "START matched\n") {
+		t.Errorf("Unexpected trace %d %q", status, out)
+	}
+
+	status, out, _ = runCommand([]string{"trace", "-json", path, "show", "all"}, "")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	var event map[string]interface{}
+	if status != 1 || json.Unmarshal([]byte(lines[len(lines)-1]), &event) != nil || event["event"] != "exit" {
+		t.Errorf("Unexpected JSON trace %d %q", status, out)
+	}
+
+	status, _, errOut := runCommand([]string{"trace", path, "-json", "show", "users"}, "")
+	if status != 2 || !strings.HasPrefix(errOut, "flag -json must come before GRAMMARFILE\n") {
+		t.Errorf("Expected a flag after the grammar file to be rejected, got %d %q", status, errOut)
+	}
+	status, out, _ = runCommand([]string{"trace", path, "--", "show", "-json"}, "")
+	if status != 1 || !strings.Contains(out, "try Target at - at 1:6\n") {
+		t.Errorf("Expected -json after -- as input, got %d %q", status, out)
+	}
+}
+
+func TestTraceReport(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	status, out, _ := runCommand([]string{"trace", "-tree", path, "show", "users"}, "")
+	if status != 0 || !strings.Contains(out, "  Target matched users\n") || !strings.Contains(out, "parse tree:\n") {
+		t.Errorf("Unexpected tree %d %q", status, out)
+	}
+
+	status, out, _ = runCommand([]string{"trace", "-html", path, "show", "all"}, "")
+	if status != 1 || !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.Contains(out, "<td>all at 1:6</td>") {
+		t.Errorf("Unexpected HTML report %d %q", status, out)
+	}
+}
+
+func TestGrammarTests(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	cases := filepath.Join(t.TempDir(), "show.test")
+	os.WriteFile(cases, []byte("show users => match\nshow all => match\nshow groups admins =>\n"), 0644)
+	status, out, _ := runCommand([]string{"test", path, cases}, "")
+	if status != 1 || !strings.Contains(out, cases+":2: show all\nexpected: match\ngot: no match\n") {
+		t.Errorf("Expected failed cases, got %d %q", status, out)
+	}
+
+	status, _, _ = runCommand([]string{"test", "-update", path, cases}, "")
+	data, _ := os.ReadFile(cases)
+	if status != 0 || !strings.HasPrefix(string(data), "show users => match\nshow all => no match\nshow groups admins => match\n  START\n") {
+		t.Errorf("Expected the results in the test file, got %d %q", status, data)
+	}
+	status, _, _ = runCommand([]string{"test", path, cases}, "")
+	if status != 0 {
+		t.Errorf("Expected the updated cases to pass, got %d", status)
+	}
+}
+
+func TestCover(t *testing.T) {
+	path := writeGrammar(t, testGrammar)
+	cases := filepath.Join(t.TempDir(), "show.test")
+	os.WriteFile(cases, []byte("show users => match\nshow all => no match\n"), 0644)
+	status, out, _ := runCommand([]string{"cover", path, cases}, "")
+	if status != 0 || !strings.Contains(out, "Target: 1 of 2 calls matched, 1 of 2 alternatives covered\n") || !strings.Contains(out, "  - ToClause?: 0 of 1 tries matched\n") {
+		t.Errorf("Unexpected coverage %d %q", status, out)
+	}
+
+	_, out, _ = runCommand([]string{"cover", "-json", path, cases}, "")
+	var output struct{ Rules, RulesCovered int }
+	if err := json.Unmarshal([]byte(out), &output); err != nil || output.RulesCovered != 2 {
+		t.Errorf("Unexpected JSON coverage %q", out)
+	}
+
+	_, out, _ = runCommand([]string{"cover", "-html", path, cases}, "")
+	if !strings.HasPrefix(out, "<!DOCTYPE html>") || !strings.Contains(out, `<tr class="rule missed"><td>ToClause</td>`) {
+		t.Errorf("Unexpected HTML coverage %q", out)
+	}
+}
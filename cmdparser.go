@@ -1,16 +1,21 @@
 package cmdparser
 
 import (
-	"errors"
 	"fmt"
-	"golang.org/x/exp/utf8string"
+	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"text/scanner"
 	"unicode/utf8"
 )
 
+// itemCount matches the {n}, {n,} and {n,m} count suffix of an item
+var itemCount = regexp.MustCompile(`\{\s*(\d+)\s*(,\s*(\d*)\s*)?\}$`)
+
+// listOperator matches the list operator and the blanks around it
+var listOperator = regexp.MustCompile(`\s*(` + LISTSTRING + `{1,2})\s*`)
+
 // NewParser creates a new parser instance
 func NewParser() *CommandParser {
 	return &CommandParser{
@@ -18,6 +23,7 @@ func NewParser() *CommandParser {
 		inputLine:   "",
 		grammar:     map[string]string{},
 		rules:       map[string]*RuleStruct{},
+		tokenizer:   NewDefaultTokenizer(),
 		ParseResult: map[string]CmdToken{},
 	}
 }
@@ -27,214 +33,187 @@ func (theParser *CommandParser) SetOptions(options uint64) {
 	theParser.options = options
 }
 
-// SetCommandGrammar load the map with the grammar into the parser
+// SetReservedWords sets the words that are not matched by !ident, so an
+// identifier can't shadow a command. See OptionReserveKeywords, too.
+func (theParser *CommandParser) SetReservedWords(words ...string) {
+	theParser.reserved = map[string]bool{}
+	for _, word := range words {
+		theParser.reserved[word] = true
+	}
+}
+
+// isReserved reports if a word is reserved or, with OptionReserveKeywords, a keyword of the grammar
+func (theParser *CommandParser) isReserved(word string) bool {
+	return theParser.reserved[word] || (theParser.options&OptionReserveKeywords != 0 && theParser.keywords[word])
+}
+
+// SetCommandGrammar load the map with the grammar into the parser.
+// An item that can't be compiled never matches, Lint reports it.
 func (theParser *CommandParser) SetCommandGrammar(cg map[string]string) {
+	theParser.compileRules(cg)
 	for k, v := range cg {
 		theParser.grammar[k] = v
-		theParser.rules[k] = theParser.prepareRule(k, v)
-	}
-	if theParser.options&OptionDebug != 0 {
-		for i, v := range theParser.rules["START"].Items {
-			fmt.Println(i, ":", v)
-		}
 	}
+	theParser.grammarChanged()
 }
 
-// SetInputString feeds the command line input into the parser for procesing
-func (theParser *CommandParser) SetInputString(inputLine string) {
-	theParser.inputLine = inputLine
-	theParser.TokenizeCommandLine()
+// CompileGrammar loads the map with the grammar into the parser like
+// SetCommandGrammar. An item that can't be compiled, a missing START rule and
+// a call of an undefined rule are returned as a GrammarError, the grammar of
+// the parser is unchanged then. SetCommandGrammar leaves the undefined rules
+// to Lint.
+func (theParser *CommandParser) CompileGrammar(cg map[string]string) error {
+	saved := map[string]*RuleStruct{}
+	for name, rule := range theParser.rules {
+		saved[name] = rule
+	}
+	err := theParser.compileRules(cg)
+	if err == nil {
+		err = checkCalls(theParser.rules)
+	}
+	if err != nil {
+		theParser.rules = saved
+		return err
+	}
+	for k, v := range cg {
+		theParser.grammar[k] = v
+	}
+	theParser.grammarChanged()
+	return nil
 }
 
-func (theParser *CommandParser) golangTokenizer(line string) []*PreToken {
-	var theScanner scanner.Scanner
-	result := []*PreToken{}
-	theScanner.Init(strings.NewReader(line))
-	theScanner.Mode = scanner.ScanFloats | scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings
-	tok := theScanner.Scan()
-	for tok != scanner.EOF && tok != COMMENTCHAR {
-		s := theScanner.TokenText()
-		theToken := &PreToken{
-			Type:     tok,
-			Text:     s,
-			Position: theScanner.Position,
+// compileRules prepares the rules of a grammar and adds them to the parser.
+// The first item, by rule name, that can't be compiled is returned.
+func (theParser *CommandParser) compileRules(cg map[string]string) error {
+	names := []string{}
+	for name := range cg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var result error
+	for _, name := range names {
+		rule, err := theParser.prepareRule(name, cg[name])
+		if err != nil && result == nil {
+			result = err
 		}
-		result = append(result, theToken)
-		tok = theScanner.Scan()
+		theParser.rules[name] = rule
 	}
 	return result
 }
 
-func tokenFromIdentifier(preToken *PreToken) (*CmdToken, error) {
-	low := strings.ToLower(preToken.Text)
-	token := &CmdToken{
-		Position: preToken.Position,
+// checkCalls reports a missing START rule and the first item, by rule name,
+// that calls an undefined rule
+func checkCalls(rules map[string]*RuleStruct) error {
+	if rules["START"] == nil {
+		return &GrammarError{Rule: "START", Err: ErrMissingRule}
 	}
-	var err error
-	// process booleans
-	if low == "true" || low == "yes" || low == "false" || low == "no" {
-		token.Text = low
-		token.Type = TokenBool
-		token.Value = (low == "yes" || low == "true")
-	} else {
-		token.Text = preToken.Text
-		token.Type = TokenIdent
-		token.Value = preToken.Text
+	names := []string{}
+	for name := range rules {
+		names = append(names, name)
 	}
-	return token, err
+	sort.Strings(names)
+	for _, name := range names {
+		for _, item := range rules[name].Items {
+			for _, called := range []*RuleItem{item, item.Separator} {
+				if called != nil && (called.ExprType == SymbolExpr || called.ExprType == PredicateExpr || called.ExprType == NotPredicateExpr) && rules[called.ExprString] == nil {
+					return &GrammarError{Rule: name, Item: called.ExprString, Err: ErrMissingRule}
+				}
+			}
+		}
+	}
+	return nil
 }
 
-func tokenFromInt(preToken *PreToken) (*CmdToken, error) {
-	var err error
-	token := &CmdToken{
-		Text:     preToken.Text,
-		Type:     TokenInt,
-		Position: preToken.Position,
+// grammarChanged updates what is derived from the rules after rules were added
+func (theParser *CommandParser) grammarChanged() {
+	theParser.markLeftRecursion()
+	usedFlags := theParser.usesFlags
+	theParser.usesFlags = false
+	theParser.keywords = map[string]bool{}
+	for _, rule := range theParser.rules {
+		for _, item := range rule.Items {
+			switch item.ExprType {
+			case FlagExpr:
+				theParser.usesFlags = true
+			case IdentifierExpr:
+				theParser.keywords[item.ExprString] = true
+			}
+		}
 	}
-	val, err := strconv.Atoi(preToken.Text)
-	if err == nil {
-		token.Value = val
-	} else {
-		token.Value = nil
-		token.Type = TokenERR
-		err = errors.New("NOT_AN_INT")
+	if theParser.usesFlags != usedFlags && theParser.inputLine != "" {
+		// the flags of the input are only combined for a grammar with flags
+		theParser.TokenizeCommandLine()
 	}
-	return token, err
 }
 
-func tokenFromFloat(preToken *PreToken) (*CmdToken, error) {
-	var err error
-	token := &CmdToken{
-		Text:     preToken.Text,
-		Type:     TokenFloat,
-		Position: preToken.Position,
+// SetTokenizer replaces the tokenizer that converts the input line into tokens.
+// Passing nil restores the default tokenizer.
+func (theParser *CommandParser) SetTokenizer(tokenizer Tokenizer) {
+	if tokenizer == nil {
+		tokenizer = NewDefaultTokenizer()
 	}
-	val, err := strconv.ParseFloat(preToken.Text, 64)
-	if err == nil {
-		token.Value = val
-	} else {
-		token.Value = nil
-		token.Type = TokenERR
-		err = errors.New("NOT_A_FLOAT")
+	theParser.tokenizer = tokenizer
+}
+
+// SetInputString feeds the command line input into the parser for procesing.
+// A tokenizer error is returned and also reported by Err. The input is a single
+// statement, a STATEMENTSEPARATOR is an ordinary char here. ParseStatements
+// and ParseScript split the statements.
+func (theParser *CommandParser) SetInputString(inputLine string) error {
+	theParser.inputLine = inputLine
+	return theParser.TokenizeCommandLine()
+}
+
+// SetTokens feeds an already tokenized command into the parser, bypassing the tokenizer
+func (theParser *CommandParser) SetTokens(tokens []*CmdToken) {
+	theParser.inputLine = ""
+	theParser.TokenizerError = false
+	theParser.tokenizerErr = nil
+	theParser.tokenList = append([]*CmdToken{}, tokens...)
+}
+
+// TokenizeCommandLine creates the list of CmdParser tokens from the input line,
+// using the tokenizer of the parser. The error is also kept for Err and Parse.
+func (theParser *CommandParser) TokenizeCommandLine() error {
+	tokens, err := theParser.tokenize(theParser.inputLine)
+	theParser.TokenizerError = err != nil
+	theParser.tokenizerErr = err
+	if err != nil {
+		tokens = nil
 	}
-	return token, err
+	theParser.tokenList = tokens
+	return err
 }
 
-func tokenFromString(preToken *PreToken) (*CmdToken, error) {
-	var err error
-	token := &CmdToken{
-		Text:     preToken.Text,
-		Type:     TokenString,
-		Position: preToken.Position,
+// tokenize runs the tokenizer, resolves the variables and expands the aliases of the input
+func (theParser *CommandParser) tokenize(line string) ([]*CmdToken, error) {
+	tokens, err := theParser.tokenizer.Tokenize(line)
+	if err == nil {
+		tokens, err = theParser.interpolate(line, tokens)
 	}
-	val, err := strconv.Unquote(preToken.Text)
 	if err == nil {
-		token.Value = val
-	} else {
-		token.Value = nil
-		token.Type = TokenERR
-		err = errors.New("COULD_NOT_UNQUOTE")
+		tokens, err = theParser.expandAliases(tokens)
 	}
-	return token, err
+	if err == nil && theParser.usesFlags {
+		// only a grammar with flags reads "-v" as a flag instead of '-' and v
+		tokens = combineFlags(tokens)
+	}
+	return tokens, err
 }
 
-func tokenFromChar(preToken *PreToken) (*CmdToken, error) {
-	var err error
-	token := &CmdToken{
-		Text:     preToken.Text,
-		Type:     TokenChar,
-		Position: preToken.Position,
-	}
-	r, _ := utf8.DecodeRuneInString(preToken.Text)
-	token.Value = r
-	return token, err
+// Err returns the error that prevents the current input from being parsed, nil otherwise
+func (theParser *CommandParser) Err() error {
+	return theParser.tokenizerErr
 }
 
-// watch out, different signature from the rest, because we must combine more than
-// one pretoken to form the expression string
-func tokenFromExpression(preTokens []*PreToken, startIndex int) (*CmdToken, int, error) {
-	var err error
-	currIndex := startIndex
-	token := &CmdToken{
-		Text:     "",
-		Type:     TokenExpr,
-		Position: preTokens[currIndex].Position,
-	}
-	if preTokens[currIndex].Text == "'" {
-		tmpStr := ""
-		for {
-			currIndex++
-			// are we done with the expression?
-			if currIndex >= len(preTokens) || preTokens[currIndex].Type == '\'' {
-				break
-			}
-			tmpStr += preTokens[currIndex].Text
-		}
-		token.Text = tmpStr
-		token.Type = TokenExpr
-		token.Value = preTokens[startIndex:currIndex]
-	} else {
-		token.Value = nil
-		token.Type = TokenERR
-		err = errors.New("MISSING_SINGLE_QUOTE")
-	}
-	return token, currIndex, err
+// Errors returns the messages collected during the last Parse
+func (theParser *CommandParser) Errors() []*ParseError {
+	return theParser.errorList
 }
 
-// TokenizeCommandLine creates the list of CmdParser tokens. to make things easier
-// we first use the internal scanner from GO, then post-process the tokens from the scanner.
-func (theParser *CommandParser) TokenizeCommandLine() {
-	preTokens := theParser.golangTokenizer(theParser.inputLine)
-	postTokens := []*CmdToken{}
-	var err error
-	var postTok *CmdToken
-	index := 0
-	for {
-		tok := preTokens[index]
-		switch tok.Type {
-		case scanner.Ident:
-			postTok, err = tokenFromIdentifier(tok)
-			if err == nil {
-				postTokens = append(postTokens, postTok)
-			}
-		case scanner.Int:
-			postTok, err = tokenFromInt(tok)
-			if err == nil {
-				postTokens = append(postTokens, postTok)
-			}
-		case scanner.Float:
-			postTok, err = tokenFromFloat(tok)
-			if err == nil {
-				postTokens = append(postTokens, postTok)
-			}
-		case scanner.String:
-			postTok, err = tokenFromString(tok)
-			if err == nil {
-				postTokens = append(postTokens, postTok)
-			}
-		case '\'':
-			postTok, index, err = tokenFromExpression(preTokens, index)
-			if err == nil {
-				postTokens = append(postTokens, postTok)
-			}
-		default:
-			postTok, err = tokenFromChar(tok)
-			if err == nil {
-				postTokens = append(postTokens, postTok)
-			}
-		}
-		if err != nil {
-			postTokens = nil
-			theParser.TokenizerError = true
-		} else {
-			theParser.TokenizerError = false
-		}
-		index++
-		if index >= len(preTokens) {
-			break
-		}
-	}
-	theParser.tokenList = postTokens
+// Tokens returns the tokens of the current input
+func (theParser *CommandParser) Tokens() []*CmdToken {
+	return theParser.tokenList
 }
 
 // convenience function to dump the token list of the parser
@@ -255,8 +234,8 @@ func copyToken(tok *CmdToken) *CmdToken {
 // peek a token without advancing the input token list
 func (theParser *CommandParser) peek() *CmdToken {
 	var result *CmdToken
-	if len(theParser.tokenList) > 0 {
-		result = copyToken(theParser.tokenList[0])
+	if theParser.tokenPos < len(theParser.tokens) {
+		result = copyToken(theParser.tokens[theParser.tokenPos])
 	}
 	return result
 }
@@ -264,39 +243,109 @@ func (theParser *CommandParser) peek() *CmdToken {
 // consume a token from the input token list
 func (theParser *CommandParser) read() *CmdToken {
 	var result *CmdToken
-	if len(theParser.tokenList) > 0 {
-		result = theParser.tokenList[0]
-		theParser.tokenList = append([]*CmdToken{}, theParser.tokenList[1:]...)
+	if theParser.tokenPos < len(theParser.tokens) {
+		result = theParser.tokens[theParser.tokenPos]
+		theParser.tokenPos++
 	}
 	return result
 }
 
-// un-read a token back into the token list
+// un-read the token that was read last
 func (theParser *CommandParser) unread(tok *CmdToken) {
 	if tok != nil {
-		theParser.tokenList = append([]*CmdToken{tok}, theParser.tokenList...)
+		theParser.tokenPos--
 	}
 }
 
-func (theParser *CommandParser) splitRule(ruleString string) ([]string, GrammarItemType) {
-	var temp []string
+// columnAt returns the column of the token at a position of the input, 0 at the end
+func (theParser *CommandParser) columnAt(pos int) int {
+	if pos < len(theParser.tokens) {
+		return theParser.tokens[pos].Position.Column
+	}
+	return 0
+}
+
+// splitRule splits a rule into its items and returns the type of the rule.
+// A rule with both | and & at the top level is an error, a group like
+// ("a" | "b") & "c" tells which operator comes first.
+func (theParser *CommandParser) splitRule(ruleString string) ([]string, GrammarItemType, error) {
 	result := []string{}
-	var resultType GrammarItemType
+	var resultType GrammarItemType = Sequence
+	var err error
 
-	if strings.Index(ruleString, CHOICESTRING) > 0 {
-		resultType = Choice
-		temp = strings.Split(ruleString, CHOICESTRING)
-	} else {
-		resultType = Sequence
-		temp = strings.Split(ruleString, " ")
+	// ITEM % SEP is a single item
+	ruleString = listOperator.ReplaceAllString(ruleString, "$1")
+	alternatives := [][]string{{}}
+	for pos := 0; pos < len(ruleString); {
+		end := itemEnd(ruleString, pos)
+		item := ruleString[pos:end]
+		switch {
+		case strings.TrimSpace(item) == "":
+		case item == CHOICESTRING:
+			if resultType == Permutation {
+				err = ErrMixedOperators
+			}
+			resultType = Choice
+			alternatives = append(alternatives, []string{})
+		case item == PERMUTATIONSTRING:
+			if resultType == Choice {
+				err = ErrMixedOperators
+			}
+			resultType = Permutation
+			alternatives = append(alternatives, []string{})
+		default:
+			alternatives[len(alternatives)-1] = append(alternatives[len(alternatives)-1], item)
+		}
+		pos = end
+	}
+	if resultType == Sequence {
+		return alternatives[0], resultType, nil
 	}
+	for _, alternative := range alternatives {
+		if len(alternative) > 1 {
+			// an alternative of several items is a group
+			result = append(result, "("+strings.Join(alternative, " ")+")")
+		} else if len(alternative) == 1 {
+			result = append(result, alternative[0])
+		}
+	}
+	return result, resultType, err
+}
 
-	for i := range temp {
-		if strings.TrimSpace(temp[i]) != "" {
-			result = append(result, strings.TrimSpace(temp[i]))
+// itemEnd returns the end of the rule item that starts at pos. Blanks inside
+// quotes, classes, groups and counts don't end an item.
+func itemEnd(ruleString string, pos int) int {
+	if c := ruleString[pos]; c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+		for pos < len(ruleString) && strings.ContainsRune(" \t\n\r", rune(ruleString[pos])) {
+			pos++
+		}
+		return pos
+	}
+	if c := ruleString[pos]; (c == '|' || c == '&') && (pos+1 == len(ruleString) || ruleString[pos+1] != '(') {
+		return pos + 1
+	}
+	depth := 0
+	var quote byte
+	for i := pos; i < len(ruleString); i++ {
+		c := ruleString[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			depth--
+		case depth == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '|' || (c == '&' && i > pos)):
+			return i
 		}
 	}
-	return result, resultType
+	return len(ruleString)
 }
 
 func (theParser *CommandParser) expressionType(expr string) GrammarItemType {
@@ -310,6 +359,8 @@ func (theParser *CommandParser) expressionType(expr string) GrammarItemType {
 		result = ClassExpr
 	case '!':
 		result = DataTypeExpr
+	case '-':
+		result = FlagExpr
 	default:
 		result = SymbolExpr
 	}
@@ -318,6 +369,10 @@ func (theParser *CommandParser) expressionType(expr string) GrammarItemType {
 
 func (theParser *CommandParser) expressionCardinality(expr string) GrammarItemCardinality {
 	var result GrammarItemCardinality
+	if itemCount.MatchString(expr) {
+		// an explicit count, see prepareCount
+		return CardinalityOne
+	}
 	switch expr[len(expr)-1] {
 	case '*':
 		result = CardinalityZeroOrMore
@@ -331,18 +386,25 @@ func (theParser *CommandParser) expressionCardinality(expr string) GrammarItemCa
 	return result
 }
 
-func (theParser *CommandParser) prepareRule(name, expression string) *RuleStruct {
+// prepareRule compiles the expression of a rule, the rules of its groups are
+// added to the parser. An item that can't be compiled is kept as an invalid
+// item, the first one is returned.
+func (theParser *CommandParser) prepareRule(name, expression string) (*RuleStruct, error) {
+	var result error
 	items := []*RuleItem{}
-	ruleItems, ruleType := theParser.splitRule(expression)
+	ruleItems, ruleType, err := theParser.splitRule(expression)
 	rs := &RuleStruct{
 		Name:  name,
 		Items: items,
 		Type:  ruleType,
 	}
+	if err != nil {
+		rs.invalid = &GrammarError{Rule: name, Item: expression, Err: err}
+		result = rs.invalid
+	}
 	for _, ruleItem := range ruleItems {
 		item := &RuleItem{
 			Cardinality: theParser.expressionCardinality(ruleItem),
-			ExprType:    theParser.expressionType(ruleItem),
 			ExprString:  ruleItem,
 			ParentRule:  rs,
 			Seen:        false,
@@ -351,43 +413,222 @@ func (theParser *CommandParser) prepareRule(name, expression string) *RuleStruct
 			// strip out cardinality char
 			item.ExprString = item.ExprString[0 : len(item.ExprString)-1]
 		}
-		switch item.ExprType {
-		case IdentifierExpr, CharExpr:
-			// remove quotes
-			item.ExprString = item.ExprString[1 : len(item.ExprString)-1]
-		case DataTypeExpr:
-			// remove exclamation mark
-			item.ExprString = item.ExprString[1:]
-		}
-		// TODO: find a better way to extract runes from a string
-		if item.ExprType == CharExpr {
-			s := utf8string.NewString(item.ExprString)
-			r := s.At(1)
-			if r == '\'' {
-				item.ExprString = s.String()
-			} else {
-				panic("CharExpr does not contain rune literal!")
+		item.MinOccur, item.MaxOccur = getCardinality(item)
+		hasCount := prepareCount(item)
+		if i := listIndex(item.ExprString); i > 0 {
+			if err := theParser.prepareList(item, i, hasCount); err != nil && result == nil {
+				result = err
 			}
 		}
+		predicate := ""
+		if strings.HasPrefix(item.ExprString, "&(") || strings.HasPrefix(item.ExprString, "~(") {
+			predicate, item.ExprString = item.ExprString[:1], item.ExprString[1:]
+		}
+		if strings.HasPrefix(item.ExprString, "(") && strings.HasSuffix(item.ExprString, ")") {
+			if err := theParser.prepareGroup(item, len(rs.Items)); err != nil && result == nil {
+				result = err
+			}
+		}
+		if err := theParser.prepareExpression(item); err != nil {
+			item.invalid = &GrammarError{Rule: name, Item: ruleItem, Err: err}
+			if result == nil {
+				result = item.invalid
+			}
+		}
+		switch predicate {
+		case "&":
+			item.ExprType = PredicateExpr
+		case "~":
+			item.ExprType = NotPredicateExpr
+		}
 		rs.Items = append(rs.Items, item)
 	}
-	return rs
+	return rs, result
 }
 
-func matchClassExpr(theClass string, tokptr *CmdToken) bool {
-	itemMatch, err := regexp.MatchString(theClass, tokptr.Text)
-	if err != nil {
-		itemMatch = false
-	} else {
-		itemMatch = tokptr.Type == TokenString
+// listIndex returns the index of the list operator in an item or -1
+func listIndex(expr string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && c == LISTSTRING[0]:
+			return i
+		}
 	}
-	return itemMatch
+	return -1
+}
+
+// prepareCount removes a count suffix like {2,5} from the expression of an item
+// and sets the number of occurrences, {2,} has no upper limit
+func prepareCount(item *RuleItem) bool {
+	m := itemCount.FindStringSubmatch(item.ExprString)
+	if m == nil {
+		return false
+	}
+	item.ExprString = item.ExprString[:len(item.ExprString)-len(m[0])]
+	item.MinOccur, _ = strconv.Atoi(m[1])
+	item.MaxOccur = item.MinOccur
+	if m[2] != "" {
+		item.MaxOccur = Unbounded
+		if m[3] != "" {
+			item.MaxOccur, _ = strconv.Atoi(m[3])
+		}
+	}
+	return true
+}
+
+// prepareGroup replaces the group ( ... ) by a generated rule. The rule is
+// named after the parent rule and the index of the item, like START.2, the
+// names of the results of the group start with this name.
+func (theParser *CommandParser) prepareGroup(item *RuleItem, index int) error {
+	name := item.ParentRule.Name + "." + strconv.Itoa(index+1)
+	rule, err := theParser.prepareRule(name, item.ExprString[1:len(item.ExprString)-1])
+	theParser.rules[name] = rule
+	item.ExprString = name
+	return err
+}
+
+// prepareList splits the list item ITEM%SEP or ITEM%%SEP at the list operator.
+// A list has at least one element unless it is optional, a count suffix like
+// {2,5} sets the number of elements.
+func (theParser *CommandParser) prepareList(item *RuleItem, i int, hasCount bool) error {
+	sep := item.ExprString[i+1:]
+	item.ExprString = item.ExprString[:i]
+	if strings.HasPrefix(sep, LISTSTRING) {
+		item.TrailingSeparator = true
+		sep = sep[1:]
+	}
+	if !hasCount {
+		// without a count, the cardinality tells if the list may be empty
+		item.MaxOccur = Unbounded
+	}
+	item.Separator = &RuleItem{
+		Cardinality: CardinalityOne,
+		ExprString:  sep,
+		ParentRule:  item.ParentRule,
+	}
+	if err := theParser.prepareExpression(item.Separator); err != nil {
+		item.Separator.invalid = &GrammarError{Rule: item.ParentRule.Name, Item: sep, Err: err}
+		return item.Separator.invalid
+	}
+	return nil
+}
+
+// prepareExpression sets the type of an item and removes the type markers from its expression
+func (theParser *CommandParser) prepareExpression(item *RuleItem) error {
+	if item.ExprString == "" || item.MinOccur > item.MaxOccur {
+		// a count like {3,1} never matches
+		return ErrInvalidGrammarItem
+	}
+	item.ExprType = theParser.expressionType(item.ExprString)
+	switch item.ExprType {
+	case IdentifierExpr, CharExpr:
+		if len(item.ExprString) < 2 || item.ExprString[len(item.ExprString)-1] != item.ExprString[0] {
+			return ErrInvalidGrammarItem
+		}
+		// remove quotes
+		item.ExprString = item.ExprString[1 : len(item.ExprString)-1]
+	case DataTypeExpr:
+		// remove exclamation mark
+		item.ExprString = item.ExprString[1:]
+		if dataType(item.ExprString) == TokenERR {
+			return ErrInvalidGrammarItem
+		}
+	case FlagExpr:
+		// split --name=!type into the flag and the type of its value
+		if i := strings.Index(item.ExprString, "=!"); i > 0 {
+			item.FlagValue = item.ExprString[i+2:]
+			item.ExprString = item.ExprString[:i]
+			if dataType(item.FlagValue) == TokenERR {
+				return ErrInvalidGrammarItem
+			}
+		}
+	}
+	if item.ExprType == ClassExpr {
+		regex, err := regexp.Compile(item.ExprString)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidGrammarItem, err)
+		}
+		item.regex = regex
+	}
+	if item.ExprType == CharExpr && utf8.RuneCountInString(item.ExprString) != 1 {
+		// a char item is a single rune
+		return ErrInvalidGrammarItem
+	}
+	return nil
+}
+
+// matchClassExpr matches the value of a string token against the precompiled class
+func matchClassExpr(theClass *regexp.Regexp, tokptr *CmdToken) bool {
+	if tokptr.Type != TokenString {
+		return false
+	}
+	s, _ := tokptr.Value.(string)
+	return theClass.MatchString(s)
 }
 
 func matchDataTypeExpr(theDataType TokenType, tokptr *CmdToken) bool {
 	return tokptr.Type == theDataType
 }
 
+// dataType returns the token type for the name of a !datatype item
+func dataType(name string) TokenType {
+	var reqType TokenType
+	switch strings.ToLower(name) {
+	case "expression":
+		reqType = TokenExpr
+	case "string":
+		reqType = TokenString
+	case "int":
+		reqType = TokenInt
+	case "bool":
+		reqType = TokenBool
+	case "float":
+		reqType = TokenFloat
+	case "char":
+		reqType = TokenChar
+	case "ident":
+		reqType = TokenIdent
+	default:
+		reqType = TokenERR
+	}
+	return reqType
+}
+
+// matchDataType matches a token against a data type. The arguments of ParseArgs
+// are strings, so in this mode !string matches every plain argument and the
+// token is converted to a string token.
+func (theParser *CommandParser) matchDataType(name string, tokptr *CmdToken) (*CmdToken, bool) {
+	reqType := dataType(name)
+	if reqType == TokenIdent && theParser.isReserved(tokptr.Text) {
+		return tokptr, false
+	}
+	if matchDataTypeExpr(reqType, tokptr) {
+		return tokptr, true
+	}
+	if theParser.argsMode && reqType == TokenString && tokptr.Type != TokenFlag {
+		result := copyToken(tokptr)
+		result.Type = TokenString
+		result.Value = tokptr.Text
+		return result, true
+	}
+	return tokptr, false
+}
+
 func getCardinality(ruleItemPtr *RuleItem) (minxOccur, maxOccur int) {
 	min := 0
 	max := 0
@@ -397,31 +638,51 @@ func getCardinality(ruleItemPtr *RuleItem) (minxOccur, maxOccur int) {
 		max = 1
 	case CardinalityOneOrMore:
 		min = 1
-		max = 1 << 32
+		max = Unbounded
 	case CardinalityZeroOrOne:
 		min = 0
 		max = 1
 	case CardinalityZeroOrMore:
 		min = 0
-		max = 1 << 32
+		max = Unbounded
 	}
 	return min, max
 }
 
+// matchRuleItem matches an item once at the token the caller has read and
+// sends the try and the match or fail events to the tracer
 func (theParser *CommandParser) matchRuleItem(ruleItemPtr *RuleItem, tokptr *CmdToken) bool {
+	pos := theParser.tokenPos
+	if tokptr != nil {
+		pos--
+	}
+	theParser.trace(TraceTryItem, ruleItemPtr.ParentRule, ruleItemPtr, pos, false)
+	isMatch := theParser.matchItemAt(ruleItemPtr, tokptr)
+	if isMatch {
+		theParser.trace(TraceMatch, ruleItemPtr.ParentRule, ruleItemPtr, pos, true)
+	} else {
+		theParser.trace(TraceFail, ruleItemPtr.ParentRule, ruleItemPtr, pos, false)
+	}
+	return isMatch
+}
+
+// matchItemAt matches an item once at the token the caller has read
+func (theParser *CommandParser) matchItemAt(ruleItemPtr *RuleItem, tokptr *CmdToken) bool {
 	isMatch := false
 	ruleItemPtr.Seen = true
 
-	if theParser.options&OptionDebug != 0 {
-		fmt.Println("ruleItem:", ruleItemPtr.String())
-		if tokptr != nil {
-			fmt.Println("tokenPtr:", tokptr.String())
-		} else {
-			fmt.Println("tokenPtr is NIL!")
-		}
+	if ruleItemPtr.invalid != nil {
+		// an item that can't be compiled never matches, see Lint
+		return false
 	}
 
-	if tokptr == nil {
+	if ruleItemPtr.ExprType == PredicateExpr || ruleItemPtr.ExprType == NotPredicateExpr {
+		// predicates look ahead, the input is not consumed
+		return theParser.matchPredicate(ruleItemPtr, tokptr)
+	}
+	if tokptr == nil && ruleItemPtr.ExprType != SymbolExpr {
+		// a rule may match without input at the end, like a permutation of
+		// optional items
 		return false
 	}
 
@@ -431,34 +692,25 @@ func (theParser *CommandParser) matchRuleItem(ruleItemPtr *RuleItem, tokptr *Cmd
 	case IdentifierExpr:
 		isMatch = tokptr.Type == TokenIdent && ruleItemPtr.ExprString == tokptr.Value
 	case ClassExpr:
-		isMatch = matchClassExpr(ruleItemPtr.ExprString, tokptr)
+		isMatch = matchClassExpr(ruleItemPtr.regex, tokptr)
 	case SymbolExpr:
 		if tokptr != nil {
 			theParser.unread(tokptr)
 		}
-		isMatch = theParser.matchRule(theParser.rules[ruleItemPtr.ExprString])
+		start := len(theParser.captures)
+		if isMatch = theParser.matchRule(theParser.calledRule(ruleItemPtr)); isMatch {
+			theParser.captureCall(ruleItemPtr, tokptr, start)
+			return true
+		}
 	case DataTypeExpr:
-		dtStr := strings.ToLower(ruleItemPtr.ExprString)
-		var reqType TokenType
-		switch dtStr {
-		case "expression":
-			reqType = TokenExpr
-		case "string":
-			reqType = TokenString
-		case "int":
-			reqType = TokenInt
-		case "bool":
-			reqType = TokenBool
-		case "float":
-			reqType = TokenFloat
-		case "char":
-			reqType = TokenChar
-		}
-		isMatch = matchDataTypeExpr(reqType, tokptr)
+		tokptr, isMatch = theParser.matchDataType(ruleItemPtr.ExprString, tokptr)
+	case FlagExpr:
+		// a flag as an alternative of a choice, flags of a sequence are handled by matchFlags
+		isMatch = tokptr.Type == TokenFlag && ruleItemPtr.ExprString == tokptr.Text
 	}
 
 	if isMatch {
-		ruleItemPtr.TokenPtr = tokptr
+		theParser.capture(ruleItemPtr, tokptr)
 	}
 
 	if !isMatch {
@@ -470,137 +722,443 @@ func (theParser *CommandParser) matchRuleItem(ruleItemPtr *RuleItem, tokptr *Cmd
 	return isMatch
 }
 
+// matchItemWithToken matches an item as often as its cardinality or count allows.
+// The caller has read the first token. If the item does not match, the input is
+// left as it was, so the next alternative of a choice can be tried.
 func (theParser *CommandParser) matchItemWithToken(ruleItemPtr *RuleItem) bool {
-	result := false
+	if ruleItemPtr.Separator != nil {
+		return theParser.matchList(ruleItemPtr)
+	}
+	theParser.unread(theParser.tokptr)
+	start, capturesStart := theParser.tokenPos, len(theParser.captures)
 	var matchCount int
-	minOccur, maxOccur := getCardinality(ruleItemPtr)
+	for matchCount < ruleItemPtr.MaxOccur {
+		if matchCount > 0 && !theParser.matchFlags() {
+			// flags may be given between the repetitions
+			theParser.backtrack(ruleItemPtr.ParentRule, start, capturesStart)
+			theParser.tokptr = theParser.read()
+			return false
+		}
+		saved, savedCaptures, savedErrors := theParser.tokenPos, len(theParser.captures), len(theParser.errorList)
+		theParser.tokptr = theParser.read()
+		if !theParser.matchRuleItem(ruleItemPtr, theParser.tokptr) {
+			theParser.backtrack(ruleItemPtr.ParentRule, saved, savedCaptures)
+			if matchCount >= ruleItemPtr.MinOccur {
+				// the item matches without this repetition, its errors don't count
+				theParser.errorList = theParser.errorList[:savedErrors]
+			}
+			break
+		}
+		matchCount++
+		if theParser.tokenPos == saved {
+			// the item matched without input, don't loop forever
+			break
+		}
+	}
+	if matchCount < ruleItemPtr.MinOccur {
+		if ruleItemPtr.MinOccur > 1 {
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: theParser.columnAt(start), Message: "Rule " + ruleItemPtr.ParentRule.Name + ", " + countMessage(ruleItemPtr, matchCount)})
+		}
+		theParser.backtrack(ruleItemPtr.ParentRule, start, capturesStart)
+		theParser.tokptr = theParser.read()
+		return false
+	}
+	return true
+}
 
-	for {
-		match := theParser.matchRuleItem(ruleItemPtr, theParser.tokptr)
+// matchPredicate matches the group of a predicate and restores the input.
+// &( ... ) matches if the group matches, ~( ... ) if it does not.
+func (theParser *CommandParser) matchPredicate(ruleItemPtr *RuleItem, tokptr *CmdToken) bool {
+	theParser.unread(tokptr)
+	savedPos, savedErrors, savedCaptures := theParser.tokenPos, len(theParser.errorList), len(theParser.captures)
+	match := theParser.matchRule(theParser.calledRule(ruleItemPtr))
+	theParser.backtrack(ruleItemPtr.ParentRule, savedPos, savedCaptures)
+	theParser.errorList = theParser.errorList[:savedErrors]
+	if ruleItemPtr.ExprType == NotPredicateExpr {
+		match = !match
+		if !match && tokptr != nil {
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: tokptr.Position.Column, Message: "Rule " + ruleItemPtr.ParentRule.Name + ", unexpected " + tokptr.Text})
+		}
+	}
+	return match
+}
 
-		// no annotation means ONE
-		if minOccur == 1 && maxOccur == 1 {
-			result = match
-			break
+// countMessage describes the expected number of values of an item
+func countMessage(item *RuleItem, got int) string {
+	expected := strconv.Itoa(item.MinOccur)
+	if item.MaxOccur == Unbounded {
+		expected = "at least " + expected
+	} else if item.MaxOccur != item.MinOccur {
+		expected += " to " + strconv.Itoa(item.MaxOccur)
+	}
+	return "expected " + expected + " values, got " + strconv.Itoa(got)
+}
+
+// matchList matches the elements of a list item and captures them as a single
+// list token. A separator must be followed by an element, unless the list
+// allows a trailing separator. A list with more elements than its count allows
+// doesn't match.
+func (theParser *CommandParser) matchList(item *RuleItem) bool {
+	theParser.unread(theParser.tokptr)
+	start, capturesStart := theParser.tokenPos, len(theParser.captures)
+	values := []CmdToken{}
+	var last *CmdToken
+	for len(values) < item.MaxOccur {
+		if len(values) > 0 && !theParser.matchFlags() {
+			// flags may be given between the elements
+			theParser.backtrack(item.ParentRule, start, capturesStart)
+			theParser.tokptr = theParser.read()
+			return false
 		}
-		if match {
-			matchCount++
-			result = match
-			// match a matching Expr+ or a Expr*
-			if maxOccur >= 1<<32 || (minOccur == 0 && maxOccur == 1) {
-				theParser.tokptr = theParser.read()
-				// break out, if token is nil => matching read until end of input
-				if theParser.tokptr == nil {
-					result = match
-					break
-				}
-			}
-			// too many matches?
-			if maxOccur == 1 && matchCount > 1 {
-				result = false
+		beforeSep, capturesBeforeSep, errorsBeforeSep := theParser.tokenPos, len(theParser.captures), len(theParser.errorList)
+		if len(values) > 0 {
+			if !theParser.matchRuleItem(item.Separator, theParser.read()) {
+				theParser.backtrack(item.ParentRule, beforeSep, capturesBeforeSep)
+				theParser.errorList = theParser.errorList[:errorsBeforeSep]
 				break
 			}
-		} else {
-			// match a Expr?
-			if minOccur == 0 || matchCount >= minOccur {
-				result = true
-				if theParser.tokptr != nil {
-					theParser.unread(theParser.tokptr)
-				}
-				break
+			last = item.Separator.TokenPtr
+			if !theParser.matchFlags() {
+				theParser.backtrack(item.ParentRule, start, capturesStart)
+				theParser.tokptr = theParser.read()
+				return false
 			}
-			if matchCount < minOccur {
-				result = false
-				break
+		}
+		beforeElement, capturesBeforeElement := theParser.tokenPos, len(theParser.captures)
+		if !theParser.matchRuleItem(item, theParser.read()) {
+			theParser.backtrack(item.ParentRule, beforeElement, capturesBeforeElement)
+			if !item.TrailingSeparator {
+				theParser.backtrack(item.ParentRule, beforeSep, capturesBeforeSep)
 			}
+			// the list ends here, its count decides if it matches
+			theParser.errorList = theParser.errorList[:errorsBeforeSep]
+			break
 		}
+		values = append(values, *item.TokenPtr)
+		last = item.TokenPtr
 	}
-	return result
+	got := len(values)
+	if got == item.MaxOccur {
+		got += theParser.extraElements(item)
+	}
+	if got < item.MinOccur || got > item.MaxOccur {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: theParser.columnAt(start), Message: "Rule " + item.ParentRule.Name + ", " + countMessage(item, got)})
+		// leave the input as it was for the next alternative
+		theParser.backtrack(item.ParentRule, start, capturesStart)
+		theParser.tokptr = theParser.read()
+		theParser.capture(item, nil)
+		return false
+	}
+	if len(values) == 0 {
+		theParser.capture(item, nil)
+		return true
+	}
+	list := &CmdToken{Type: TokenList, Value: values, Position: values[0].Position, End: last.End}
+	texts := []string{}
+	for _, v := range values {
+		texts = append(texts, v.Text)
+	}
+	sep := " " + item.Separator.ExprString + " "
+	if item.Separator.ExprType == CharExpr {
+		sep = item.Separator.ExprString + " "
+	}
+	list.Text = strings.Join(texts, sep)
+	theParser.captureCall(item, list, capturesStart)
+	return true
+}
+
+// extraElements counts the elements that follow a list with the maximum number
+// of elements, the input is left as it was
+func (theParser *CommandParser) extraElements(item *RuleItem) int {
+	pos, capturesStart, errorsStart := theParser.tokenPos, len(theParser.captures), len(theParser.errorList)
+	count := 0
+	for theParser.matchRuleItem(item.Separator, theParser.read()) && theParser.matchRuleItem(item, theParser.read()) {
+		count++
+	}
+	theParser.backtrack(item.ParentRule, pos, capturesStart)
+	theParser.errorList = theParser.errorList[:errorsStart]
+	return count
 }
 
+// matchRule matches a rule at the current position and sends the enter and
+// exit events of the rule to the tracer
 func (theParser *CommandParser) matchRule(rule *RuleStruct) bool {
-	if theParser.options&OptionDebug != 0 {
-		fmt.Println("Trying to match ", rule.Name)
+	if rule == nil || rule.invalid != nil {
+		// an undefined rule never matches, see calledRule, and neither
+		// does a rule that can't be compiled
+		return false
+	}
+	theParser.trace(TraceEnterRule, rule, nil, theParser.tokenPos, false)
+	theParser.traceDepth++
+	match := theParser.recallRule(rule)
+	theParser.traceDepth--
+	theParser.trace(TraceExitRule, rule, nil, theParser.tokenPos, match)
+	return match
+}
+
+// calledRule returns the rule an item calls, an undefined rule is reported.
+// SetCommandGrammar accepts a grammar with undefined rules.
+func (theParser *CommandParser) calledRule(item *RuleItem) *RuleStruct {
+	rule := theParser.rules[item.ExprString]
+	if rule == nil {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: 0, Message: "Rule " + item.ParentRule.Name + ", missing rule " + item.ExprString})
+	}
+	return rule
+}
+
+// recallRule matches a rule at the current position. With OptionMemoize the
+// result is kept per rule and position, a rule that is tried again at the same
+// position replays its captures instead of matching the input again.
+func (theParser *CommandParser) recallRule(rule *RuleStruct) bool {
+	if rule.leftRecursive {
+		return theParser.matchLeftRecursive(rule)
 	}
+	if theParser.memo == nil {
+		return theParser.applyRule(rule)
+	}
+	key := memoKey{rule: rule, pos: theParser.tokenPos}
+	if entry, ok := theParser.memo[key]; ok {
+		theParser.replay(entry)
+		return entry.match
+	}
+	capturesStart, errorsStart := len(theParser.captures), len(theParser.errorList)
+	match := theParser.applyRule(rule)
+	theParser.memo[key] = &memoEntry{
+		match:    match,
+		end:      theParser.tokenPos,
+		captures: append([]capture{}, theParser.captures[capturesStart:]...),
+		errors:   append([]*ParseError{}, theParser.errorList[errorsStart:]...),
+	}
+	return match
+}
+
+// applyRule matches the items of a rule according to its type
+func (theParser *CommandParser) applyRule(rule *RuleStruct) bool {
 	match := false
+	theParser.pushFlagScope(rule)
 
 	if rule.Type == Sequence {
 		// all must match
+		match = true
 		for _, item := range rule.Items {
-			theParser.tokptr = theParser.read()
-			if theParser.options&OptionDebug != 0 {
-				fmt.Println("Using Sequence Item:", item.String())
+			if item.ExprType == FlagExpr {
+				// flags are matched in any order between the other items
+				continue
 			}
-			match = theParser.matchItemWithToken(item)
-			if theParser.options&OptionDebug != 0 {
-				fmt.Println(">>      Result:", match)
+			if !theParser.matchFlags() {
+				match = false
+				break
 			}
+			theParser.tokptr = theParser.read()
+			match = theParser.matchItemWithToken(item)
 			if !match {
 				break
 			}
 		}
+		if match {
+			match = theParser.matchFlags()
+		}
 	} else if rule.Type == Choice {
 		// check if any of them matched
 		match = false
+		errorsStart := len(theParser.errorList)
 		theParser.tokptr = theParser.read()
 		for _, item := range rule.Items {
-			if theParser.options&OptionDebug != 0 {
-				fmt.Println("Using Choice Item:", item.String())
-			}
-			im := theParser.matchItemWithToken(item)
-			if theParser.options&OptionDebug != 0 {
-				fmt.Println("      Result:", im)
-			}
-			if im {
+			if theParser.matchItemWithToken(item) {
+				// the errors of the failed alternatives don't count
+				theParser.errorList = theParser.errorList[:errorsStart]
 				match = true
 				break
 			}
 		}
+	} else if rule.Type == Permutation {
+		match = theParser.matchPermutation(rule)
 	} else {
-		fmt.Println("You should not be here ...")
 		panic(fmt.Errorf("Invalid rule type %v", rule.Type))
 	}
 
+	if !theParser.popFlagScope() {
+		match = false
+	}
 	theParser.rules[rule.Name].seen = true
-	if theParser.options&OptionDebug != 0 {
-		fmt.Println("Done rule ", rule.Name, "  match=", match)
+	return match
+}
+
+// capture keeps the token matched by an item and logs it for the memoization
+// and the parse tree. A failed match removes its captures from the log again.
+func (theParser *CommandParser) capture(item *RuleItem, tok *CmdToken) {
+	item.TokenPtr = tok
+	theParser.captures = append(theParser.captures, capture{item: item, tok: tok})
+}
+
+// captureCall captures the token of a rule call or a list, the tokens captured
+// since start belong to it
+func (theParser *CommandParser) captureCall(item *RuleItem, tok *CmdToken, start int) {
+	theParser.capture(item, tok)
+	theParser.captures[len(theParser.captures)-1].children = len(theParser.captures) - 1 - start
+}
+
+// hasFlags reports if there are flag tokens in the input, flags are counted
+// across rules, so their rules can't be memoized
+func hasFlags(tokens []*CmdToken) bool {
+	for _, tok := range tokens {
+		if tok.Type == TokenFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPermutation matches the items of a permutation rule in any order. An item
+// without cardinality or with + is required, an item with ? or * is optional.
+// Each occurrence of an item is matched with its count and separator. Items
+// with + or * and without separator may be given more than once, any other
+// repetition is an error. An occurrence without input doesn't count.
+func (theParser *CommandParser) matchPermutation(rule *RuleStruct) bool {
+	count := map[*RuleItem]int{}
+	for !theParser.AtEnd() {
+		if !theParser.matchFlags() {
+			return false
+		}
+		first := theParser.tokenPos
+		var matched *RuleItem
+		for _, item := range rule.Items {
+			// a failed item must not consume the input for the next one
+			savedErrors, savedCaptures := len(theParser.errorList), len(theParser.captures)
+			theParser.tokptr = theParser.read()
+			if theParser.matchItemWithToken(item) && theParser.tokenPos > first {
+				matched = item
+				break
+			}
+			theParser.backtrack(rule, first, savedCaptures)
+			theParser.errorList = theParser.errorList[:savedErrors]
+		}
+		if matched == nil {
+			break
+		}
+		count[matched]++
+		if count[matched] > 1 && (matched.MaxOccur != Unbounded || matched.Separator != nil) {
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: theParser.columnAt(first), Message: "Rule " + rule.Name + ", duplicate " + matched.ExprString})
+			return false
+		}
+	}
+	match := true
+	for _, item := range rule.Items {
+		if count[item] == 0 && item.MinOccur > 0 {
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: 0, Message: "Rule " + rule.Name + ", missing " + item.ExprString})
+			match = false
+		}
 	}
 	return match
 }
 
 // AtEnd detects if the parser has processed the input stream to the end
 func (theParser *CommandParser) AtEnd() bool {
-	return len(theParser.tokenList) == 0
+	return theParser.tokenPos >= len(theParser.tokens)
 }
 
-func (theParser *CommandParser) buildParseResults() {
+// resetMatches clears the tokens captured by a previous parse
+func (theParser *CommandParser) resetMatches() {
 	for _, rule := range theParser.rules {
 		for _, v := range rule.Items {
-			key := strings.ToLower(rule.Name + "_" + v.ExprString)
-			if v.TokenPtr != nil {
-				theParser.ParseResult[key] = *v.TokenPtr
-			}
+			v.TokenPtr = nil
 		}
 	}
+	theParser.ParseResult = map[string]CmdToken{}
+	theParser.captures = nil
+}
+
+// buildParseResults fills the ParseResult from the captures log, so the tokens
+// of failed alternatives are left out and a memoized match gives the same results
+func (theParser *CommandParser) buildParseResults() {
+	for _, c := range theParser.captures {
+		if c.tok == nil {
+			delete(theParser.ParseResult, resultKey(c.item))
+		} else {
+			theParser.ParseResult[resultKey(c.item)] = *c.tok
+		}
+	}
+}
+
+// resultKey returns the key of the token of an item in the ParseResult
+func resultKey(item *RuleItem) string {
+	// the results of a filter rule are named after the filter, see filterRule
+	name := strings.TrimPrefix(item.ParentRule.Name, string(PIPECHAR))
+	return strings.ToLower(name + "_" + strings.TrimLeft(item.ExprString, "-"))
 }
 
 // Parse is the function you call to start the parsing process.
+// If filters are registered, the input is split into the command and the
+// filter stages of a pipeline, see RegisterFilter.
 func (theParser *CommandParser) Parse() bool {
-	rule := theParser.rules["START"]
+	theParser.errorList = nil
+	theParser.Stages = nil
+	// no results of the previous input are left if this one can't be parsed
+	theParser.resetMatches()
+	if theParser.tokenizerErr != nil {
+		// no point in matching an invalid token stream
+		theParser.IsMatch = false
+		return false
+	}
+	if theParser.rules["START"] == nil {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: 0, Message: "missing rule START"})
+		theParser.IsMatch = false
+		return false
+	}
+	stages := [][]*CmdToken{theParser.tokenList}
+	if len(theParser.filters) > 0 {
+		stages = splitTokens(theParser.tokenList, PIPECHAR)
+	}
+	match := theParser.parseTokens(theParser.rules["START"], stages[0])
+	commandResult, commandCaptures := theParser.ParseResult, theParser.captures
+	for _, stageTokens := range stages[1:] {
+		match = theParser.parseStage(stageTokens) && match
+	}
+	theParser.ParseResult, theParser.captures = commandResult, commandCaptures
+	theParser.IsMatch = match
+	return match
+}
+
+// parseTokens matches a list of tokens against a rule and builds the parse results
+func (theParser *CommandParser) parseTokens(rule *RuleStruct, tokens []*CmdToken) bool {
+	theParser.resetMatches()
+	theParser.tokens, theParser.tokenPos = tokens, 0
+	theParser.memo = nil
+	if theParser.options&OptionMemoize != 0 && !hasFlags(tokens) {
+		theParser.memo = map[memoKey]*memoEntry{}
+	}
+	if theParser.tracer == nil && theParser.options&OptionDebug != 0 {
+		theParser.tracer = NewTextTracer(os.Stderr)
+		defer theParser.SetTracer(nil)
+	}
+	theParser.traceDepth = 0
 	match := theParser.matchRule(rule)
 	if !theParser.AtEnd() {
 		// if there still is stuff to parse, it's not a match ...
-		match = false
-		if theParser.options&OptionDebug != 0 {
-			fmt.Println("Not at end => no match")
-			fmt.Println("Token list =>", theParser.tokenList)
+		if match {
+			tok := theParser.tokens[theParser.tokenPos]
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: tok.Position.Column, Message: "Rule " + rule.Name + ", unexpected " + tok.Text})
 		}
+		match = false
+		theParser.trace(TraceInputLeft, rule, nil, theParser.tokenPos, false)
 	}
 	theParser.buildParseResults()
-	theParser.IsMatch = match
 	return match
 }
 
+// splitTokens splits a token list at the separator char
+func splitTokens(tokens []*CmdToken, separator rune) [][]*CmdToken {
+	result := [][]*CmdToken{}
+	start := 0
+	for i, tok := range tokens {
+		if tok.Type == TokenChar && tok.Text == string(separator) {
+			result = append(result, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(result, tokens[start:])
+}
+
 // DumpRules is a convenience function to dump a rule set
 func (theParser *CommandParser) DumpRules() {
 	for _, rule := range theParser.rules {
@@ -1,6 +1,9 @@
 package cmdparser
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +44,8 @@ func TestGrammarRules(t *testing.T) {
 		grammarTestStruct{Rule: `"show" !int `, Input: ` show 42 `, Match: true},
 		grammarTestStruct{Rule: `"foo" | "bar" | "baz" `, Input: ` foo `, Match: true},
 		grammarTestStruct{Rule: `"foo" | "bar" | "baz" `, Input: ` show `, Match: false},
+		grammarTestStruct{Rule: `"table" [0-9]`, Input: ` table "log1" `, Match: true},
+		grammarTestStruct{Rule: `"table" [0-9]`, Input: ` table "log" `, Match: false},
 	}
 
 	for _, entry := range data {
@@ -95,3 +100,499 @@ func TestExpressionGrammar(t *testing.T) {
 	match := p.Parse()
 	Assert(t, match == true, "Should match input string, but does not!")
 }
+
+// keyValueTokenizer splits the input at blanks and turns key=value pairs
+// into an identifier and a string token
+type keyValueTokenizer struct{}
+
+func (kv keyValueTokenizer) Tokenize(line string) ([]*CmdToken, error) {
+	result := []*CmdToken{}
+	for _, field := range strings.Fields(line) {
+		parts := strings.SplitN(field, "=", 2)
+		result = append(result, &CmdToken{Type: TokenIdent, Text: parts[0], Value: parts[0]})
+		if len(parts) == 2 {
+			result = append(result, &CmdToken{Type: TokenString, Text: parts[1], Value: parts[1]})
+		}
+	}
+	return result, nil
+}
+
+func TestCustomTokenizer(t *testing.T) {
+	Grammar := map[string]string{
+		"START":   ` "connect" Setting+ `,
+		"Setting": ` "host" !string `,
+	}
+	p := NewParser()
+	p.SetTokenizer(keyValueTokenizer{})
+	p.SetCommandGrammar(Grammar)
+	p.SetInputString(`connect host=db.example.com:5432`)
+	match := p.Parse()
+	Assert(t, match == true, "Should match input string, but does not!")
+	Assert(t, p.ParseResult["setting_string"].Value == "db.example.com:5432", "Expected host:port value in parse result")
+}
+
+func TestEmptyInput(t *testing.T) {
+	p := NewParser()
+	p.SetInputString(`   # only a comment`)
+	Assert(t, len(p.tokenList) == 0, "Expected no tokens!")
+	Assert(t, !p.TokenizerError, "Empty input is not a tokenizer error")
+}
+
+func TestTokenizerErrors(t *testing.T) {
+	data := []struct {
+		Input  string
+		Err    error
+		Column int
+	}{
+		{Input: `show "unterminated`, Err: ErrUnterminatedString, Column: 6},
+		{Input: `list where '4 < 5`, Err: ErrMissingSingleQuote, Column: 12},
+		{Input: `show 99999999999999999999`, Err: ErrNotAnInt, Column: 6},
+		{Input: `show "bad \q escape"`, Err: ErrCouldNotUnquote, Column: 6},
+	}
+	Grammar := map[string]string{
+		"START": ` "show" !string `,
+	}
+	for _, entry := range data {
+		p := NewParser()
+		p.SetCommandGrammar(Grammar)
+		err := p.SetInputString(entry.Input)
+		var tokErr *TokenError
+		if !errors.As(err, &tokErr) {
+			t.Error("Expected a TokenError for input " + entry.Input)
+			continue
+		}
+		Assert(t, errors.Is(err, entry.Err), "Unexpected error "+err.Error()+" for input "+entry.Input)
+		Assert(t, tokErr.Position.Column == entry.Column, "Wrong error position for input "+entry.Input)
+		Assert(t, p.Err() == err && p.TokenizerError, "Parser should remember the tokenizer error")
+		Assert(t, !p.Parse(), "Parse must fail on an invalid token stream")
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(Grammar)
+	p.SetInputString(`show "de"`)
+	Assert(t, p.Parse() && len(p.ParseResult) > 0, "Expected a match")
+	p.SetInputString(`show "unterminated`)
+	Assert(t, !p.Parse() && len(p.ParseResult) == 0 && p.ParseTree() == nil, "Expected no results of the previous input")
+}
+
+func TestExpressionDelimiters(t *testing.T) {
+	tokenizer := NewDefaultTokenizer()
+	tokenizer.Delimiters = []ExprDelimiter{{Open: '\'', Close: '\''}, {Open: '{', Close: '}'}}
+	p := NewParser()
+	p.SetTokenizer(tokenizer)
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "list" "board" "where" !expression !int `,
+	})
+	input := `list board where { name == 'it''s' && tags == "{#1}" || f({x}) } 42 # comment`
+	err := p.SetInputString(input)
+	Assert(t, err == nil, "Unexpected tokenizer error")
+	Assert(t, p.Parse(), "Should match input string, but does not!")
+	tok := p.ParseResult["start_expression"]
+	Assert(t, tok.Text == ` name == 'it''s' && tags == "{#1}" || f({x}) `, "Wrong expression text ["+tok.Text+"]")
+	Assert(t, tok.Position.Column == 18 && tok.End.Column == 65, "Wrong expression span")
+	Assert(t, input[tok.Position.Offset:tok.End.Offset] == "{"+tok.Text+"}", "Span does not cover the expression")
+
+	err = p.SetInputString(`list board where { (a == "}" } 42 `)
+	Assert(t, err == nil, "Quoted delimiter must not end the expression")
+	err = p.SetInputString(`list board where { a == { b } 42 `)
+	Assert(t, errors.Is(err, ErrUnterminatedExpression), "Nested braces must be balanced")
+}
+
+func TestDefaultDelimiters(t *testing.T) {
+	p := NewParser()
+	p.SetTokenizer(&DefaultTokenizer{BoolWords: map[string]bool{"on": true, "off": false}})
+	p.SetCommandGrammar(map[string]string{"START": `"show" !expression`})
+	p.SetInputString(`show 'a > 1'`)
+	Assert(t, p.Parse() && p.ParseResult["start_expression"].Text == "a > 1", "Expected the single quote without Delimiters")
+
+	p.SetTokenizer(&DefaultTokenizer{Delimiters: []ExprDelimiter{}})
+	p.SetInputString(`show 'a > 1'`)
+	Assert(t, !p.Parse(), "Expected no expressions for empty Delimiters")
+}
+
+// A class matches only strings whose value matches its regular expression,
+// and an invalid expression is a grammar error.
+func TestClassMatchesRegexNotAnyString(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"lang" [A-Z]`})
+	p.SetInputString(`lang "DE"`)
+	Assert(t, p.Parse(), "Expected a string matching the class")
+	p.SetInputString(`lang "de"`)
+	Assert(t, !p.Parse(), "Expected a string not matching the class to fail")
+	p.SetInputString(`lang DE`)
+	Assert(t, !p.Parse(), "Expected a class to match strings only")
+	err := p.CompileGrammar(map[string]string{"START": `"lang" [a-(]`})
+	Assert(t, errors.Is(err, ErrInvalidGrammarItem) && strings.Contains(err.Error(), "[[a-(]] in rule START"), "Expected an invalid class to be an error")
+}
+
+func TestCompileGrammar(t *testing.T) {
+	p := NewParser()
+	Assert(t, p.CompileGrammar(map[string]string{"START": `"show" !ident`}) == nil, "Expected the grammar to compile")
+	for _, rule := range []string{`"show" 'ab'`, `"show`, `"show" ("all" ?)`, `!int % ''`, `!integer`, `[a-(]`, `--v=!nosuch`, `"a"{3,1}`} {
+		err := p.CompileGrammar(map[string]string{"START": rule, "Other": `"other"`})
+		var grammarErr *GrammarError
+		Assert(t, errors.As(err, &grammarErr) && errors.Is(err, ErrInvalidGrammarItem), "Expected an invalid item in "+rule)
+	}
+	_, added := p.rules["Other"]
+	Assert(t, !added && p.grammar["START"] == `"show" !ident`, "Expected the grammar to be unchanged after an error")
+	err := p.CompileGrammar(map[string]string{"START": `"show" 'ab'`})
+	Assert(t, err != nil && err.Error() == "INVALID_GRAMMAR_ITEM ['ab'] in rule START", "Unexpected error message")
+
+	err = p.CompileGrammar(map[string]string{"START": `"x" Missing`})
+	Assert(t, errors.Is(err, ErrMissingRule) && err.Error() == "MISSING_RULE [Missing] in rule START", "Expected an undefined rule to be an error")
+	err = p.CompileGrammar(map[string]string{"START": `"x" ~(Missing)`})
+	Assert(t, errors.Is(err, ErrMissingRule), "Expected an undefined rule in a predicate to be an error")
+	err = p.CompileGrammar(map[string]string{"START": `"a" | "b" & "c"`})
+	Assert(t, errors.Is(err, ErrMixedOperators) && err.Error() == `MIXED_OPERATORS ["a" | "b" & "c"] in rule START`, "Expected mixed operators to be an error")
+	Assert(t, p.CompileGrammar(map[string]string{"START": `("a" | "b") & "c"`}) == nil, "Expected a group to separate the operators")
+	err = NewParser().CompileGrammar(map[string]string{"Cmd": `"x"`})
+	Assert(t, errors.Is(err, ErrMissingRule) && err.Error() == "MISSING_RULE START", "Expected a missing START to be an error")
+}
+
+func TestSetCommandGrammarInvalidItems(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"a" !foo | "b" [a-(] | "c" --v=!nosuch | "d"`})
+	for _, input := range []string{`a x`, `b "x"`, `c --v=1`} {
+		p.SetInputString(input)
+		Assert(t, !p.Parse(), "Expected an invalid item never to match "+input)
+	}
+	p.SetInputString(`d`)
+	Assert(t, p.Parse(), "Expected the valid alternative to match")
+	issues := []string{}
+	for _, issue := range p.Lint() {
+		if issue.Kind == LintInvalidItem {
+			issues = append(issues, issue.String())
+		}
+	}
+	Assert(t, len(issues) == 3 && issues[0] == "Rule START.1, !foo can't be compiled, it never matches: INVALID_GRAMMAR_ITEM [invalid-item]", "Unexpected issues:\n"+strings.Join(issues, "\n"))
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"a"{3,1}`})
+	issues = []string{}
+	for _, issue := range p.Lint() {
+		issues = append(issues, issue.String())
+	}
+	Assert(t, len(issues) == 1 && issues[0] == `Rule START, "a"{3,1} can't be compiled, it never matches: INVALID_GRAMMAR_ITEM [invalid-item]`, "Unexpected issues:\n"+strings.Join(issues, "\n"))
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"a" & "b" | "c"`})
+	p.SetInputString(`c`)
+	Assert(t, !p.Parse(), "Expected a rule with mixed operators never to match")
+	Assert(t, len(p.Lint()) == 1 && p.Lint()[0].String() == "Rule START, can't be compiled, it never matches: MIXED_OPERATORS [invalid-item]", "Expected mixed operators in the issues")
+}
+
+func TestParseUndefinedRules(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"Cmd": `"x"`})
+	p.SetInputString(`x`)
+	Assert(t, !p.Parse() && len(p.Errors()) == 1 && p.Errors()[0].Message == "missing rule START", "Expected no match without START")
+
+	p.SetCommandGrammar(map[string]string{"START": `"show" Missing`})
+	p.SetInputString(`show foo`)
+	Assert(t, !p.Parse(), "Expected no match for an undefined rule")
+	found := false
+	for _, e := range p.Errors() {
+		found = found || e.Message == "Rule START, missing rule Missing"
+	}
+	Assert(t, found, "Expected the undefined rule to be reported")
+}
+
+func TestPermutation(t *testing.T) {
+	Grammar := map[string]string{
+		"START":   `"list" Options`,
+		"Options": `Limit? & Sort & "verbose"?`,
+		"Limit":   `"limit" !int`,
+		"Sort":    `"sort" !string`,
+	}
+	data := grammarTest{
+		{Input: `list limit 10 sort "name"`, Match: true},
+		{Input: `list sort "name" limit 10`, Match: true},
+		{Input: `list verbose sort "name"`, Match: true},
+		{Input: `list limit 10`, Match: false},
+		{Input: `list sort "name" limit 10 sort "size"`, Match: false},
+		{Input: `list sort "name" limit "x"`, Match: false},
+	}
+	p := NewParser()
+	p.SetCommandGrammar(Grammar)
+	for _, entry := range data {
+		p.SetInputString(entry.Input)
+		if p.Parse() != entry.Match {
+			t.Error("Permutation failed for " + entry.Input)
+		}
+	}
+
+	p.SetInputString(`list sort "size" limit 5`)
+	p.Parse()
+	Assert(t, p.ParseResult["limit_int"].Value == 5, "Expected limit 5")
+	Assert(t, p.ParseResult["sort_string"].Value == "size", "Expected sort size")
+	Assert(t, p.ParseResult["options_sort"].Text == "sort", "Expected the sort member to be captured")
+
+	p.SetInputString(`list limit 1 sort "a" limit 2`)
+	Assert(t, !p.Parse(), "Expected a duplicate to fail")
+	Assert(t, len(p.Errors()) > 0 && p.Errors()[0].Message == "Rule Options, duplicate Limit", "Expected a duplicate error")
+	Assert(t, p.Errors()[0].Column == 23, "Expected the column of the duplicate")
+
+	p.SetInputString(`list limit 1`)
+	p.Parse()
+	Assert(t, len(p.Errors()) > 0 && p.Errors()[0].Message == "Rule Options, missing Sort", "Expected a missing member error")
+
+	p.SetCommandGrammar(map[string]string{"Options": `Limit? & Sort?`})
+	p.SetInputString(`list`)
+	Assert(t, p.Parse(), "Expected optional members to match at the end of the input")
+	p.SetInputString(`list limit 1`)
+	Assert(t, p.Parse(), "Expected an optional member to match")
+}
+
+func TestPermutationCounts(t *testing.T) {
+	data := []struct {
+		Options string
+		Input   string
+		Match   bool
+	}{
+		{Options: `X* & "b"`, Input: `list b`, Match: true},
+		{Options: `X* & "b"`, Input: `list x b x x`, Match: true},
+		{Options: `!string{2} & "b"`, Input: `list "a" "c" b`, Match: true},
+		{Options: `!string{2} & "b"`, Input: `list "a" b`, Match: false},
+		{Options: `!string{2} & "b"`, Input: `list "a" b "c"`, Match: false},
+		{Options: `!string % ',' & "b"`, Input: `list b "a", "c"`, Match: true},
+		{Options: `!string % ',' & "b"`, Input: `list "a" b "c"`, Match: false},
+	}
+	for _, entry := range data {
+		p := NewParser()
+		p.SetCommandGrammar(map[string]string{
+			"START":   `"list" Options`,
+			"Options": entry.Options,
+			"X":       `"x"?`,
+		})
+		p.SetInputString(entry.Input)
+		Assert(t, p.Parse() == entry.Match, "Permutation "+entry.Options+" failed for "+entry.Input)
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START":   `"list" Options`,
+		"Options": `!string % ',' & "b"`,
+	})
+	p.SetInputString(`list b "a", "c"`)
+	Assert(t, p.Parse(), "Expected the list member to match")
+	values, _ := p.ParseResult["options_string"].Value.([]CmdToken)
+	Assert(t, len(values) == 2 && values[1].Value == "c", "Expected the list as a single value")
+}
+
+func TestListOperator(t *testing.T) {
+	data := grammarTest{
+		{Rule: `"lang" !string % ','`, Input: `lang "de", "it", "fr"`, Match: true},
+		{Rule: `"lang" !string % ','`, Input: `lang "de"`, Match: true},
+		{Rule: `"lang" !string % ','`, Input: `lang`, Match: false},
+		{Rule: `"lang" !string % ','`, Input: `lang "de", "it",`, Match: false},
+		{Rule: `"lang" !string %% ','`, Input: `lang "de", "it",`, Match: true},
+		{Rule: `"lang" !string % ','*`, Input: `lang`, Match: true},
+		{Rule: `"lang" !string%','{2,3}`, Input: `lang "de"`, Match: false},
+		{Rule: `"lang" !string%','{2,3}`, Input: `lang "de", "it", "fr"`, Match: true},
+		{Rule: `"lang" !string%','{2,3}`, Input: `lang "de", "it", "fr", "en"`, Match: false},
+		{Rule: `"sum" !int % "and" "done"`, Input: `sum 1 and 2 and 3 done`, Match: true},
+		{Rule: `"lang" !string % ',' ','`, Input: `lang "de", "it",`, Match: true},
+	}
+	for _, entry := range data {
+		p := NewParser()
+		p.SetCommandGrammar(map[string]string{"START": entry.Rule})
+		p.SetInputString(entry.Input)
+		if p.Parse() != entry.Match {
+			t.Error("List rule " + entry.Rule + " failed for " + entry.Input)
+		}
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"lang" !string % ','{2,}`})
+	p.SetInputString(`lang "de", "it", "fr"`)
+	Assert(t, p.Parse(), "Expected the list to match")
+	list := p.ParseResult["start_string"]
+	Assert(t, list.Type == TokenList, "Expected a list token")
+	values, _ := list.Value.([]CmdToken)
+	Assert(t, len(values) == 3 && values[2].Value == "fr", "Expected three values")
+	Assert(t, list.Text == `"de", "it", "fr"`, "Expected the text of the list, got "+list.Text)
+
+	p.SetInputString(`lang "de"`)
+	Assert(t, !p.Parse(), "Expected a short list to fail")
+	Assert(t, len(p.Errors()) > 0 && strings.HasSuffix(p.Errors()[0].Message, "got 1"), "Expected a count error")
+
+	p.SetCommandGrammar(map[string]string{"START": `"lang" !string % ','{2,3}`})
+	p.SetInputString(`lang "de", "it", "fr", "en"`)
+	Assert(t, !p.Parse() && len(p.Errors()) == 1 && p.Errors()[0].Message == "Rule START, expected 2 to 3 values, got 4", "Expected a count error for a long list")
+
+	// the errors of a list that is left out don't count
+	for rule, input := range map[string]string{`"lang" (!string % ',')?`: `lang`, `"lang" !string % ','{2,3} | "lang" !string`: `lang "de"`} {
+		p = NewParser()
+		p.SetCommandGrammar(map[string]string{"START": rule})
+		p.SetInputString(input)
+		Assert(t, p.Parse() && len(p.Errors()) == 0, "Expected no errors after a match of "+rule)
+	}
+}
+
+func TestBoundedRepetition(t *testing.T) {
+	data := grammarTest{
+		{Rule: `"point" !float{3}`, Input: `point 1.0 2.0 3.0`, Match: true},
+		{Rule: `"point" !float{3}`, Input: `point 1.0 2.0`, Match: false},
+		{Rule: `"point" !float{3}`, Input: `point 1.0 2.0 3.0 4.0`, Match: false},
+		{Rule: `"tags" !string{1,}`, Input: `tags "a" "b" "c" "d"`, Match: true},
+		{Rule: `"tags" !string{1,}`, Input: `tags`, Match: false},
+		{Rule: `"top" !int{0,2} "done"`, Input: `top done`, Match: true},
+		{Rule: `"top" !int{0,2} "done"`, Input: `top 1 2 done`, Match: true},
+		{Rule: `"top" !int{0,2} "done"`, Input: `top 1 2 3 done`, Match: false},
+		{Rule: `"set" ("key" !string)+`, Input: `set key "a" key "b"`, Match: true},
+		{Rule: `"set" ("key" !string){2}`, Input: `set key "a"`, Match: false},
+		{Rule: `"lang" !string (',' !string)*`, Input: `lang "de", "it", "fr"`, Match: true},
+		{Rule: `"sort" ("asc" | "desc")?`, Input: `sort desc`, Match: true},
+		{Rule: `"show" "all" | "show" "one"`, Input: `show one`, Match: true},
+	}
+	for _, entry := range data {
+		p := NewParser()
+		p.SetCommandGrammar(map[string]string{"START": entry.Rule})
+		p.SetInputString(entry.Input)
+		if p.Parse() != entry.Match {
+			t.Error("Rule " + entry.Rule + " failed for " + entry.Input)
+		}
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"point" !float{3}`})
+	p.SetInputString(`point 1.0 2.0`)
+	Assert(t, !p.Parse(), "Expected two values to fail")
+	Assert(t, len(p.Errors()) > 0 && p.Errors()[0].Message == "Rule START, expected 3 values, got 2", "Expected a count error")
+	Assert(t, p.Errors()[0].Column == 7, "Expected the column of the first value")
+
+	p.SetCommandGrammar(map[string]string{"START": `"move" ("to" !int !int)`})
+	p.SetInputString(`move to 3 4`)
+	Assert(t, p.Parse(), "Expected the group to match")
+	Assert(t, p.ParseResult["start.2_to"].Text == "to", "Expected the result of the group")
+}
+
+func TestPredicates(t *testing.T) {
+	data := grammarTest{
+		{Rule: `"copy" !string &("to") "to" !string`, Input: `copy "a" to "b"`, Match: true},
+		{Rule: `"copy" !string &("to") "to" !string`, Input: `copy "a" "b"`, Match: false},
+		{Rule: `"drop" ~("all" | "everything") !string?`, Input: `drop "users"`, Match: true},
+		{Rule: `"drop" ~("all" | "everything") !string?`, Input: `drop all`, Match: false},
+		{Rule: `"list" !int? ~(!int)`, Input: `list 5`, Match: true},
+		{Rule: `"list" !int? ~(!int)`, Input: `list`, Match: true},
+	}
+	for _, entry := range data {
+		p := NewParser()
+		p.SetCommandGrammar(map[string]string{"START": entry.Rule})
+		p.SetInputString(entry.Input)
+		if p.Parse() != entry.Match {
+			t.Error("Rule " + entry.Rule + " failed for " + entry.Input)
+		}
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START":  `"show" Target`,
+		"Target": `Named | "all"`,
+		"Named":  `~("all") !string?`,
+	})
+	p.SetInputString(`show all`)
+	Assert(t, p.Parse(), "Expected the choice to fall back to all")
+	_, ok := p.ParseResult["named_string"]
+	Assert(t, !ok, "Expected no name for all")
+	Assert(t, p.ParseResult["target_all"].Text == "all", "Expected all")
+}
+
+func TestReservedWords(t *testing.T) {
+	Grammar := map[string]string{
+		"START":   `Command`,
+		"Command": `ShowCmd | DropCmd`,
+		"ShowCmd": `"show" !ident`,
+		"DropCmd": `"drop" !ident`,
+	}
+	p := NewParser()
+	p.SetCommandGrammar(Grammar)
+	p.SetInputString(`show drop`)
+	Assert(t, p.Parse(), "Expected drop to be an identifier without reserved words")
+
+	p.SetOptions(OptionReserveKeywords)
+	Assert(t, !p.Parse(), "Expected the keyword drop to be reserved")
+	p.SetInputString(`show users`)
+	Assert(t, p.Parse(), "Expected users to match !ident")
+	Assert(t, p.ParseResult["showcmd_ident"].Value == "users", "Expected the identifier")
+
+	p.SetOptions(0)
+	p.SetReservedWords("users", "groups")
+	Assert(t, !p.Parse(), "Expected users to be reserved")
+}
+
+func TestBoolWords(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"show" !ident`})
+	p.SetInputString(`show no`)
+	Assert(t, !p.Parse(), "Expected no to be a boolean by default")
+
+	p.SetTokenizer(&DefaultTokenizer{BoolWords: map[string]bool{"on": true, "off": false}})
+	p.SetInputString(`show no`)
+	Assert(t, p.Parse(), "Expected no to be an identifier")
+	p.SetCommandGrammar(map[string]string{"START": `"show" !bool`})
+	p.SetInputString(`show OFF`)
+	Assert(t, p.Parse() && p.ParseResult["start_bool"].Value == false, "Expected off to be false")
+	Assert(t, p.ParseArgs([]string{"show", "on"}) && p.ParseResult["start_bool"].Value == true, "Expected on to be true in the args")
+}
+
+func TestMemoize(t *testing.T) {
+	Grammar := map[string]string{
+		"START":   `Command % ';'`,
+		"Command": `"show" Target Filter? | "show" Target "all" | "drop" Target`,
+		"Target":  `"feature" !string | "table" [^a-z_]`,
+		"Filter":  `"where" !expression`,
+	}
+	inputs := []string{
+		`show feature "de" where 'x > 3'; drop table "users"`,
+		`show table "x" all; show feature "it"`,
+		`show feature "de" all`,
+		`drop table "users"`,
+		`show table "xyz"`,
+	}
+	for _, input := range inputs {
+		p := NewParser()
+		p.SetCommandGrammar(Grammar)
+		p.SetInputString(input)
+		match := p.Parse()
+		result := p.ParseResult
+
+		p.SetOptions(OptionMemoize)
+		Assert(t, p.Parse() == match, "Expected the same match with memoization for "+input)
+		Assert(t, len(p.ParseResult) == len(result), "Expected the same results with memoization for "+input)
+		for k, v := range result {
+			Assert(t, p.ParseResult[k].Text == v.Text, "Expected the same result "+k+" with memoization")
+		}
+	}
+}
+
+func TestMemoizedResults(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `A | B`, "A": `!ident "y"`, "B": `!ident "z"`})
+	p.SetInputString(`x z`)
+	Assert(t, p.Parse() && p.ParseResult["b_ident"].Text == "x", "Expected the ident of B")
+	_, found := p.ParseResult["a_ident"]
+	Assert(t, !found, "Expected no result of the failed alternative A")
+
+	for _, grammar := range []map[string]string{arithmeticGrammar, commandGrammar} {
+		p := NewParser()
+		p.SetCommandGrammar(grammar)
+		g := NewGenerator(p, 3)
+		for i := 0; i < 100; i++ {
+			input, _ := g.Generate()
+			p.SetInputString(input)
+			p.SetOptions(0)
+			p.Parse()
+			result := p.ParseResult
+			p.SetOptions(OptionMemoize)
+			p.Parse()
+			Assert(t, reflect.DeepEqual(p.ParseResult, result), "Expected the same results with memoization for "+input)
+		}
+	}
+}
+
+func TestTokenTypeValues(t *testing.T) {
+	// callers may have stored the values, new types are added at the end
+	Assert(t, TokenExpr == 7 && TokenERR == 8, "Expected the values of the original token types")
+	Assert(t, TokenFlag == 9 && TokenList == 10, "Expected the new token types after TokenERR")
+}
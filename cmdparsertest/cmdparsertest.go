@@ -0,0 +1,303 @@
+// Package cmdparsertest runs the test cases of text files against a grammar,
+// so a grammar can be tested without writing Go code.
+//
+// A test file has one case per line, the input and the expected result
+// separated by "=>":
+//
+//	# comments and blank lines are kept
+//	show users => match
+//	show all => no match
+//	show "users => error UNTERMINATED_STRING ["users] at col 6
+//	show groups admins => match
+//	  START
+//	    "show" = show
+//	    Target
+//	      "groups" = groups
+//	      !ident = admins
+//
+// The input ends at the first "=>" of a line, so an input can't contain "=>".
+// The indented lines below a match are the expected parse tree, see
+// ParseNode.String. A case without a tree only checks that the input matches.
+// With update, like the -update flag of the cmdparser test command, the
+// results are written to the files. A case with an empty expectation, like
+// `show users =>`, is filled in with the result and the tree.
+package cmdparsertest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/derlinkshaender/cmdparser"
+)
+
+// the kinds of results of a case
+const (
+	Match   = "match"
+	NoMatch = "no match"
+	Error   = "error"
+)
+
+// separator separates the input of a case from the expected result
+const separator = "=>"
+
+// ErrInvalidCase is reported for a line of a test file that is not a case
+var ErrInvalidCase = errors.New("INVALID_TEST_CASE")
+
+// Result is the result of parsing an input. Kind is Match, NoMatch or Error,
+// Error is the message of the tokenizer error and Tree the parse tree of a match.
+type Result struct {
+	Kind  string
+	Error string
+	Tree  string
+}
+
+// Case is a test case of a test file, Expect.Kind is empty if the result is
+// not known yet
+type Case struct {
+	Line   int
+	Input  string
+	Expect Result
+	// comment are the comment and blank lines above the case
+	comment []string
+}
+
+// File is a test file with its cases
+type File struct {
+	Path  string
+	Cases []*Case
+	// trailer are the comment and blank lines below the last case
+	trailer []string
+}
+
+// T is the part of testing.TB used by Run, so the package does not depend on
+// the testing package
+type T interface {
+	Helper()
+	Error(args ...interface{})
+	Fatal(args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Failure is a case whose result is not the expected one
+type Failure struct {
+	Path string
+	Case *Case
+	Got  Result
+}
+
+// String describes the result of a case, a tree follows on indented lines
+func (result Result) String() string {
+	s := result.Kind
+	if result.Kind == Error {
+		s += " " + result.Error
+	}
+	if result.Tree != "" {
+		s += "\n" + indent(result.Tree)
+	}
+	return s
+}
+
+// String describes a failure like a compiler error
+func (failure Failure) String() string {
+	return failure.Path + ":" + strconv.Itoa(failure.Case.Line) + ": " + failure.Case.Input +
+		"\nexpected: " + failure.Case.Expect.String() + "\ngot: " + failure.Got.String()
+}
+
+// Read reads the cases of a test file, path is used in the errors
+func Read(r io.Reader, path string) (*File, error) {
+	file := &File{Path: path}
+	comment := []string{}
+	var current *Case
+	tree := []string{}
+	done := func() {
+		if current != nil && len(tree) > 0 {
+			current.Expect.Tree = unindent(tree)
+		}
+		tree = []string{}
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed[0] == cmdparser.COMMENTCHAR:
+			done()
+			current = nil
+			comment = append(comment, line)
+		case line[0] == ' ' || line[0] == '\t':
+			if current == nil || current.Expect.Kind != Match {
+				return nil, &cmdparser.ScriptError{File: path, Line: n, Column: 1, Err: ErrInvalidCase}
+			}
+			tree = append(tree, line)
+		default:
+			done()
+			i := strings.Index(line, separator)
+			if i < 0 {
+				return nil, &cmdparser.ScriptError{File: path, Line: n, Column: 1, Err: ErrInvalidCase}
+			}
+			// the first "=>" ends the input
+			current = &Case{Line: n, Input: strings.TrimSpace(line[:i]), comment: comment}
+			comment = []string{}
+			expect := strings.TrimSpace(line[i+len(separator):])
+			switch {
+			case expect == Match || expect == NoMatch || expect == "":
+				current.Expect.Kind = expect
+			case strings.HasPrefix(expect, Error+" "):
+				current.Expect = Result{Kind: Error, Error: strings.TrimSpace(expect[len(Error):])}
+			default:
+				return nil, &cmdparser.ScriptError{File: path, Line: n, Column: i + 1, Err: ErrInvalidCase}
+			}
+			file.Cases = append(file.Cases, current)
+		}
+	}
+	done()
+	file.trailer = comment
+	return file, scanner.Err()
+}
+
+// ReadFile reads a test file, see Read
+func ReadFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, path)
+}
+
+// Write writes the cases with their comments and expected results
+func (file *File) Write(w io.Writer) error {
+	var b strings.Builder
+	for _, c := range file.Cases {
+		for _, line := range c.comment {
+			b.WriteString(line + "\n")
+		}
+		b.WriteString(c.Input + " " + separator)
+		if c.Expect.Kind != "" {
+			b.WriteString(" " + c.Expect.String())
+		}
+		b.WriteString("\n")
+	}
+	for _, line := range file.trailer {
+		b.WriteString(line + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Save writes the file to its path
+func (file *File) Save() error {
+	f, err := os.Create(file.Path)
+	if err != nil {
+		return err
+	}
+	if err := file.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Parse parses an input and returns the result with the parse tree
+func Parse(p *cmdparser.CommandParser, input string) Result {
+	if err := p.SetInputString(input); err != nil {
+		return Result{Kind: Error, Error: err.Error()}
+	}
+	if !p.Parse() {
+		return Result{Kind: NoMatch}
+	}
+	return Result{Kind: Match, Tree: p.ParseTree().String()}
+}
+
+// Check reports if the result is the expected one. The tree is only compared
+// if the case has one.
+func (c *Case) Check(got Result) bool {
+	switch {
+	case c.Expect.Kind != got.Kind:
+		return false
+	case got.Kind == Error:
+		return c.Expect.Error == got.Error
+	case got.Kind == Match && c.Expect.Tree != "":
+		return c.Expect.Tree == got.Tree
+	}
+	return true
+}
+
+// Update makes the result the expected one. A case without a tree keeps
+// matching without one, a new case gets the tree.
+func (c *Case) Update(got Result) {
+	if c.Expect.Kind == Match && c.Expect.Tree == "" {
+		got.Tree = ""
+	}
+	c.Expect = got
+}
+
+// RunFile runs the cases of a test file and returns the failed ones. With
+// update the results are written to the file, there are no failures then.
+func RunFile(p *cmdparser.CommandParser, path string, update bool) ([]Failure, error) {
+	file, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	failures := []Failure{}
+	for _, c := range file.Cases {
+		got := Parse(p, c.Input)
+		switch {
+		case update:
+			c.Update(got)
+		case !c.Check(got):
+			failures = append(failures, Failure{Path: path, Case: c, Got: got})
+		}
+	}
+	if update {
+		return failures, file.Save()
+	}
+	return failures, nil
+}
+
+// Run runs the test files matching the pattern, like "testdata/*.test", and
+// reports the failed cases. With update the results are written to the files,
+// the test usually passes the value of its own -update flag.
+func Run(t T, p *cmdparser.CommandParser, pattern string, update bool) {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no test files match %s", pattern)
+	}
+	for _, path := range paths {
+		failures, err := RunFile(p, path, update)
+		if err != nil {
+			t.Error(err)
+		}
+		for _, failure := range failures {
+			t.Error(failure.String())
+		}
+	}
+}
+
+// indent indents the lines of a tree below its case
+func indent(tree string) string {
+	lines := strings.Split(strings.TrimSuffix(tree, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "  " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unindent removes the indentation of the first line from the lines of a tree
+func unindent(lines []string) string {
+	prefix := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimPrefix(line, prefix) + "\n")
+	}
+	return b.String()
+}
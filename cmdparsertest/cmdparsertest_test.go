@@ -0,0 +1,108 @@
+package cmdparsertest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/derlinkshaender/cmdparser"
+)
+
+var testGrammar = map[string]string{
+	"START":  `"show" Target`,
+	"Target": `"users" | "groups" !ident`,
+}
+
+const testFile = `# the cases of the tests
+show users => match
+show all => no match
+show "users => error UNTERMINATED_STRING ["users] at col 6
+show groups admins => match
+  START
+    "show" = show
+    Target
+      "groups" = groups
+      !ident = admins
+
+show groups =>
+`
+
+// writeFile writes a test file and returns its path
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "show.test")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newParser() *cmdparser.CommandParser {
+	p := cmdparser.NewParser()
+	p.SetCommandGrammar(testGrammar)
+	return p
+}
+
+func TestRead(t *testing.T) {
+	file, err := Read(strings.NewReader(testFile), "show.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Cases) != 5 || file.Cases[3].Line != 5 || file.Cases[4].Expect.Kind != "" {
+		t.Errorf("Unexpected cases %v", file.Cases)
+	}
+	if !strings.HasPrefix(file.Cases[3].Expect.Tree, "START\n  \"show\" = show\n") {
+		t.Errorf("Expected the tree without indentation, got %q", file.Cases[3].Expect.Tree)
+	}
+	var b strings.Builder
+	file.Write(&b)
+	if b.String() != testFile {
+		t.Errorf("Expected the file to be written as it was read, got %q", b.String())
+	}
+
+	_, err = Read(strings.NewReader("show users => maybe\n"), "show.test")
+	var scriptErr *cmdparser.ScriptError
+	if !errors.As(err, &scriptErr) || !errors.Is(err, ErrInvalidCase) || scriptErr.Line != 1 {
+		t.Errorf("Expected an invalid case, got %v", err)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	p := newParser()
+	path := writeFile(t, testFile)
+	failures, err := RunFile(p, path, false)
+	if err != nil || len(failures) != 1 || failures[0].Case.Input != "show groups" || failures[0].Got.Kind != NoMatch {
+		t.Fatalf("Expected the new case to fail, got %v %v", failures, err)
+	}
+	if !strings.HasPrefix(failures[0].String(), path+":12: show groups\nexpected: \ngot: no match") {
+		t.Errorf("Unexpected failure %q", failures[0].String())
+	}
+
+	path = writeFile(t, strings.Replace(testFile, "show all => no match", "show all => match", 1))
+	failures, _ = RunFile(p, path, false)
+	if len(failures) != 2 || failures[0].Case.Line != 3 {
+		t.Errorf("Expected a wrong expectation to fail, got %v", failures)
+	}
+
+	failures, err = RunFile(p, path, true)
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("Expected no failures with update, got %v %v", failures, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "show all => no match\n") || !strings.HasSuffix(string(data), "\nshow groups => no match\n") {
+		t.Errorf("Expected the results in the file, got %q", data)
+	}
+
+	path = writeFile(t, "show groups admins =>\n")
+	RunFile(p, path, true)
+	data, _ = os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "show groups admins => match\n  START\n") {
+		t.Errorf("Expected the tree of a new case, got %q", data)
+	}
+}
+
+func TestRun(t *testing.T) {
+	path := writeFile(t, strings.Replace(testFile, "show groups =>\n", "", 1))
+	Run(t, newParser(), filepath.Join(filepath.Dir(path), "*.test"), false)
+}
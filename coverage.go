@@ -0,0 +1,209 @@
+package cmdparser
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NewCoverage returns the coverage of the rules of a parser with all counts at
+// zero. It counts the parses while it is the tracer of a parser. With
+// OptionMemoize a rule that is replayed at the same position counts as a call,
+// but its items don't count again.
+func NewCoverage(p *CommandParser) *Coverage {
+	coverage := &Coverage{rules: map[string]*RuleCoverage{}}
+	names := []string{}
+	for name := range p.rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rule := p.rules[name]
+		ruleCoverage := &RuleCoverage{Rule: name, Choice: rule.Type == Choice, Items: []ItemCoverage{}}
+		for _, item := range rule.Items {
+			ruleCoverage.Items = append(ruleCoverage.Items, ItemCoverage{Item: p.itemSource(item)})
+		}
+		coverage.Rules = append(coverage.Rules, ruleCoverage)
+		coverage.rules[name] = ruleCoverage
+	}
+	return coverage
+}
+
+// Trace to implement the Tracer interface for the Coverage
+func (coverage *Coverage) Trace(event TraceEvent) {
+	rule, ok := coverage.rules[event.Rule]
+	if !ok {
+		return
+	}
+	switch event.Type {
+	case TraceEnterRule:
+		rule.Calls++
+	case TraceExitRule:
+		if event.Match {
+			rule.Matches++
+		}
+	case TraceTryItem:
+		if event.Index >= 0 && event.Index < len(rule.Items) {
+			rule.Items[event.Index].Tries++
+		}
+	case TraceMatch:
+		if event.Index >= 0 && event.Index < len(rule.Items) {
+			rule.Items[event.Index].Matches++
+		}
+	}
+}
+
+// Covered returns the number of rules and items that matched and the number
+// of all rules and items
+func (coverage *Coverage) Covered() (rules, allRules, items, allItems int) {
+	for _, rule := range coverage.Rules {
+		if rule.Matches > 0 {
+			rules++
+		}
+		for _, item := range rule.Items {
+			if item.Matches > 0 {
+				items++
+			}
+		}
+		allItems += len(rule.Items)
+	}
+	return rules, len(coverage.Rules), items, allItems
+}
+
+// Uncovered returns the rules and the items as `Rule: item` that never matched
+func (coverage *Coverage) Uncovered() []string {
+	result := []string{}
+	for _, rule := range coverage.Rules {
+		if rule.Matches == 0 {
+			result = append(result, rule.Rule)
+		}
+		for _, item := range rule.Items {
+			if item.Matches == 0 {
+				result = append(result, rule.Rule+": "+item.Item)
+			}
+		}
+	}
+	return result
+}
+
+// percent returns the part of the total in percent
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return strconv.FormatFloat(float64(n)*100/float64(total), 'f', 1, 64) + "%"
+}
+
+// coverageSummary is the line of a coverage report with the totals
+func (coverage *Coverage) coverageSummary() string {
+	rules, allRules, items, allItems := coverage.Covered()
+	return "rules: " + strconv.Itoa(rules) + " of " + strconv.Itoa(allRules) + " covered (" + percent(rules, allRules) + "), " +
+		"items: " + strconv.Itoa(items) + " of " + strconv.Itoa(allItems) + " covered (" + percent(items, allItems) + ")"
+}
+
+// itemsCovered describes how many items of a rule matched, the items of a
+// choice are alternatives
+func (rule *RuleCoverage) itemsCovered() string {
+	covered := 0
+	for _, item := range rule.Items {
+		if item.Matches > 0 {
+			covered++
+		}
+	}
+	kind := " items"
+	if rule.Choice {
+		kind = " alternatives"
+	}
+	return strconv.Itoa(covered) + " of " + strconv.Itoa(len(rule.Items)) + kind + " covered"
+}
+
+// WriteText writes the coverage as a line per rule and item, "+" marks the
+// items that matched and "-" the ones that never matched
+func (coverage *Coverage) WriteText(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(coverage.coverageSummary() + "\n")
+	for _, rule := range coverage.Rules {
+		b.WriteString(rule.Rule + ": " + strconv.Itoa(rule.Matches) + " of " + strconv.Itoa(rule.Calls) + " calls matched, " + rule.itemsCovered() + "\n")
+		for _, item := range rule.Items {
+			mark := "+"
+			if item.Matches == 0 {
+				mark = "-"
+			}
+			b.WriteString("  " + mark + " " + item.Item + ": " + strconv.Itoa(item.Matches) + " of " + strconv.Itoa(item.Tries) + " tries matched\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// jsonCoverage is the coverage in the JSON report
+type jsonCoverage struct {
+	Rules        int             `json:"rules"`
+	RulesCovered int             `json:"rulesCovered"`
+	Items        int             `json:"items"`
+	ItemsCovered int             `json:"itemsCovered"`
+	Coverage     []*RuleCoverage `json:"coverage"`
+}
+
+// WriteJSON writes the totals and the counts of each rule and item as JSON
+func (coverage *Coverage) WriteJSON(w io.Writer) error {
+	output := jsonCoverage{Coverage: coverage.Rules}
+	output.RulesCovered, output.Rules, output.ItemsCovered, output.Items = coverage.Covered()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// WriteHTML writes the coverage as a HTML page without external resources,
+// the rules and items that never matched are marked
+func (coverage *Coverage) WriteHTML(w io.Writer) error {
+	data := &htmlCoverage{Summary: coverage.coverageSummary()}
+	for _, rule := range coverage.Rules {
+		data.Rules = append(data.Rules, htmlRuleCoverage{RuleCoverage: rule, Covered: rule.itemsCovered()})
+	}
+	return coverageTemplate.Execute(w, data)
+}
+
+// htmlRuleCoverage is a rule in the HTML coverage report
+type htmlRuleCoverage struct {
+	*RuleCoverage
+	Covered string
+}
+
+// htmlCoverage is the data of the HTML coverage template
+type htmlCoverage struct {
+	Summary string
+	Rules   []htmlRuleCoverage
+}
+
+// coverageTemplate is the template of the HTML coverage report, see WriteHTML
+var coverageTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>cmdparser coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; font-family: monospace; }
+td.count { text-align: right; }
+tr.rule td { font-weight: bold; background: #f4f4f4; }
+tr.item td:first-child { padding-left: 2em; }
+tr.covered td:first-child { color: #080; }
+tr.missed td:first-child { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Grammar Coverage</h1>
+<p>{{.Summary}}</p>
+<table>
+<tr><th>Rule / Item</th><th>Matches</th><th>Calls / Tries</th><th></th></tr>
+{{range .Rules}}<tr class="rule {{if .Matches}}covered{{else}}missed{{end}}"><td>{{.Rule}}</td><td class="count">{{.Matches}}</td><td class="count">{{.Calls}}</td><td>{{.Covered}}</td></tr>
+{{range .Items}}<tr class="item {{if .Matches}}covered{{else}}missed{{end}}"><td>{{.Item}}</td><td class="count">{{.Matches}}</td><td class="count">{{.Tries}}</td><td></td></tr>
+{{end}}{{end}}</table>
+</body>
+</html>
+`))
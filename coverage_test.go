@@ -0,0 +1,49 @@
+package cmdparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(flagGrammar)
+	coverage := NewCoverage(p)
+	p.SetTracer(coverage)
+	p.SetInputString(`copy --count=3 -v "a"`)
+	Assert(t, p.Parse(), "Expected a match")
+	p.SetInputString(`copy`)
+	Assert(t, !p.Parse(), "Expected no match")
+
+	start := coverage.Rules[0]
+	Assert(t, start.Rule == "START" && start.Calls == 2 && start.Matches == 1, "Expected two calls of START")
+	Assert(t, start.Items[0] == ItemCoverage{Item: `"copy"`, Tries: 2, Matches: 2}, "Expected copy to match twice")
+	Assert(t, start.Items[2].Item == "-v?" && start.Items[2].Matches == 1, "Expected the flag to be covered")
+	expected := []string{"START: --verbose?", "START: -q?", "START: --name=!string?"}
+	Assert(t, reflect.DeepEqual(coverage.Uncovered(), expected), "Expected the flags that were not given")
+	rules, allRules, items, allItems := coverage.Covered()
+	Assert(t, rules == 1 && allRules == 1 && items == 4 && allItems == 7, "Expected the totals")
+
+	p.SetCommandGrammar(arithmeticGrammar)
+	coverage = NewCoverage(p)
+	p.SetTracer(coverage)
+	p.SetInputString(`calc 1 - 2`)
+	p.Parse()
+	var out bytes.Buffer
+	coverage.WriteText(&out)
+	text := out.String()
+	Assert(t, strings.HasPrefix(text, "rules: 5 of 8 covered (62.5%), items: 11 of 21 covered (52.4%)\n"), "Expected the totals first")
+	Assert(t, strings.Contains(text, "Expr: 5 of 7 calls matched, 2 of 3 alternatives covered\n  - (Expr '+' Term): 0 of 3 tries matched\n"), "Expected the alternatives of Expr")
+
+	out.Reset()
+	coverage.WriteJSON(&out)
+	var output jsonCoverage
+	Assert(t, json.Unmarshal(out.Bytes(), &output) == nil && output.ItemsCovered == 11 && len(output.Coverage) == 8, "Expected the coverage as JSON")
+
+	out.Reset()
+	coverage.WriteHTML(&out)
+	Assert(t, strings.Contains(out.String(), `<tr class="rule missed"><td>Factor.2</td>`), "Expected the missed group in the HTML report")
+}
@@ -0,0 +1,378 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Check type-checks the expression against the static types of the variables
+// and returns the type of the result. Unknown identifiers are an error.
+func (e *Expression) Check(types Types) (Type, error) {
+	if e.Root == nil {
+		return AnyType, e.errorf(0, "empty expression")
+	}
+	return e.check(e.Root, types)
+}
+
+func (e *Expression) check(node Node, types Types) (Type, error) {
+	switch n := node.(type) {
+	case *Literal:
+		return typeOf(n.Value), nil
+	case *Ident:
+		t, ok := types[n.Name]
+		if !ok {
+			return AnyType, e.errorf(n.At, "unknown identifier %v", n.Name)
+		}
+		return t, nil
+	case *Unary:
+		t, err := e.check(n.X, types)
+		if err != nil {
+			return t, err
+		}
+		if n.Op == "!" {
+			if t != BoolType && t != AnyType {
+				return t, e.errorf(n.At, "operator not needs a bool, not %v", t)
+			}
+			return BoolType, nil
+		}
+		if !t.isNumeric() {
+			return t, e.errorf(n.At, "operator %v needs a number, not %v", n.Op, t)
+		}
+		return t, nil
+	case *Binary:
+		x, err := e.check(n.X, types)
+		if err != nil {
+			return x, err
+		}
+		y, err := e.check(n.Y, types)
+		if err != nil {
+			return y, err
+		}
+		t, ok := binaryType(n.Op, x, y)
+		if !ok {
+			return t, e.errorf(n.At, "operator %v not defined for %v and %v", n.Op, x, y)
+		}
+		return t, nil
+	case *Call:
+		fn, ok := Funcs[n.Name]
+		if !ok {
+			return AnyType, e.errorf(n.At, "unknown function %v", n.Name)
+		}
+		if len(n.Args) != len(fn.Args) {
+			return fn.Result, e.errorf(n.At, "function %v needs %v arguments, got %v", n.Name, len(fn.Args), len(n.Args))
+		}
+		for i, arg := range n.Args {
+			t, err := e.check(arg, types)
+			if err != nil {
+				return t, err
+			}
+			if !assignable(t, fn.Args[i]) {
+				return t, e.errorf(arg.Pos(), "argument %v of %v must be %v, not %v", i+1, n.Name, fn.Args[i], t)
+			}
+		}
+		return fn.Result, nil
+	}
+	return AnyType, e.errorf(node.Pos(), "unknown node %v", node)
+}
+
+// TypesOf derives the static types for Check from the values of the variables
+func TypesOf(vars Vars) Types {
+	result := Types{}
+	for name, val := range vars {
+		norm, _ := Normalize(val)
+		result[name] = typeOf(norm)
+	}
+	return result
+}
+
+// binaryType returns the result type of an operator, false if the operand types don't fit
+func binaryType(op string, x, y Type) (Type, bool) {
+	switch op {
+	case "&&", "||":
+		return BoolType, assignable(x, BoolType) && assignable(y, BoolType)
+	case "==", "!=":
+		return BoolType, x == AnyType || y == AnyType || x == y || x.isNumeric() && y.isNumeric()
+	case "<", "<=", ">", ">=":
+		ok := x.isNumeric() && y.isNumeric() || assignable(x, StringType) && assignable(y, StringType)
+		return BoolType, ok
+	case "+":
+		if x == StringType || y == StringType {
+			return StringType, assignable(x, StringType) && assignable(y, StringType)
+		}
+		fallthrough
+	case "-", "*", "/":
+		if !x.isNumeric() || !y.isNumeric() {
+			return AnyType, false
+		}
+		if x == AnyType || y == AnyType {
+			return AnyType, true
+		}
+		if x == IntType && y == IntType {
+			return IntType, true
+		}
+		return FloatType, true
+	case "%":
+		return IntType, assignable(x, IntType) && assignable(y, IntType)
+	}
+	return AnyType, false
+}
+
+// assignable reports if a value of type t can be used where want is needed
+func assignable(t, want Type) bool {
+	return t == want || t == AnyType || want == AnyType || want == FloatType && t == IntType
+}
+
+// typeOf returns the type of a normalized value
+func typeOf(v interface{}) Type {
+	switch v.(type) {
+	case int:
+		return IntType
+	case float64:
+		return FloatType
+	case string:
+		return StringType
+	case bool:
+		return BoolType
+	}
+	return AnyType
+}
+
+// Eval evaluates the expression, the variables are looked up with the resolver
+func (e *Expression) Eval(env Resolver) (interface{}, error) {
+	if e.Root == nil {
+		return nil, e.errorf(0, "empty expression")
+	}
+	return e.eval(e.Root, env)
+}
+
+// EvalBool evaluates the expression and makes sure the result is a bool
+func (e *Expression) EvalBool(env Resolver) (bool, error) {
+	val, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := val.(bool)
+	if !ok {
+		return false, e.errorf(0, "expression is %v, not bool", typeOf(val))
+	}
+	return b, nil
+}
+
+func (e *Expression) eval(node Node, env Resolver) (interface{}, error) {
+	switch n := node.(type) {
+	case *Literal:
+		return n.Value, nil
+	case *Ident:
+		if env == nil {
+			return nil, e.errorf(n.At, "unknown identifier %v", n.Name)
+		}
+		val, ok := env.Resolve(n.Name)
+		if !ok {
+			return nil, e.errorf(n.At, "unknown identifier %v", n.Name)
+		}
+		norm, ok := Normalize(val)
+		if !ok {
+			return nil, e.errorf(n.At, "unsupported value for %v", n.Name)
+		}
+		return norm, nil
+	case *Unary:
+		x, err := e.eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		switch v := x.(type) {
+		case bool:
+			if n.Op == "!" {
+				return !v, nil
+			}
+		case int:
+			if n.Op == "-" {
+				return -v, nil
+			} else if n.Op == "+" {
+				return v, nil
+			}
+		case float64:
+			if n.Op == "-" {
+				return -v, nil
+			} else if n.Op == "+" {
+				return v, nil
+			}
+		}
+		return nil, e.errorf(n.At, "operator %v not defined for %v", n.Op, typeOf(x))
+	case *Binary:
+		x, err := e.eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		// short circuit the boolean operators
+		if b, ok := x.(bool); ok && (n.Op == "&&" && !b || n.Op == "||" && b) {
+			return b, nil
+		}
+		y, err := e.eval(n.Y, env)
+		if err != nil {
+			return nil, err
+		}
+		return e.evalBinary(n, x, y)
+	case *Call:
+		fn, ok := Funcs[n.Name]
+		if !ok {
+			return nil, e.errorf(n.At, "unknown function %v", n.Name)
+		}
+		if len(n.Args) != len(fn.Args) {
+			return nil, e.errorf(n.At, "function %v needs %v arguments, got %v", n.Name, len(fn.Args), len(n.Args))
+		}
+		args := make([]interface{}, len(n.Args))
+		for i, arg := range n.Args {
+			var err error
+			if args[i], err = e.eval(arg, env); err != nil {
+				return nil, err
+			}
+			if !assignable(typeOf(args[i]), fn.Args[i]) {
+				return nil, e.errorf(arg.Pos(), "argument %v of %v must be %v, not %v", i+1, n.Name, fn.Args[i], typeOf(args[i]))
+			}
+		}
+		val, err := fn.Fn(args)
+		if err != nil {
+			return nil, e.errorf(n.At, "%v: %v", n.Name, err.Error())
+		}
+		norm, ok := Normalize(val)
+		if !ok {
+			return nil, e.errorf(n.At, "unsupported result of %v", n.Name)
+		}
+		return norm, nil
+	}
+	return nil, e.errorf(node.Pos(), "unknown node %v", node)
+}
+
+func (e *Expression) evalBinary(n *Binary, x, y interface{}) (interface{}, error) {
+	if _, ok := binaryType(n.Op, typeOf(x), typeOf(y)); !ok {
+		return nil, e.errorf(n.At, "operator %v not defined for %v and %v", n.Op, typeOf(x), typeOf(y))
+	}
+	switch n.Op {
+	case "&&", "||":
+		return y.(bool), nil
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	}
+	if xs, ok := x.(string); ok {
+		ys := y.(string)
+		switch n.Op {
+		case "+":
+			return xs + ys, nil
+		case "<":
+			return xs < ys, nil
+		case "<=":
+			return xs <= ys, nil
+		case ">":
+			return xs > ys, nil
+		case ">=":
+			return xs >= ys, nil
+		}
+	}
+	xi, xIsInt := x.(int)
+	yi, yIsInt := y.(int)
+	if xIsInt && yIsInt {
+		switch n.Op {
+		case "+":
+			return xi + yi, nil
+		case "-":
+			return xi - yi, nil
+		case "*":
+			return xi * yi, nil
+		case "/", "%":
+			if yi == 0 {
+				return nil, e.errorf(n.At, "division by zero")
+			}
+			if n.Op == "/" {
+				return xi / yi, nil
+			}
+			return xi % yi, nil
+		}
+	}
+	xf, yf := toFloat(x), toFloat(y)
+	switch n.Op {
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	case "/":
+		if yf == 0 {
+			return nil, e.errorf(n.At, "division by zero")
+		}
+		return xf / yf, nil
+	case "<":
+		return xf < yf, nil
+	case "<=":
+		return xf <= yf, nil
+	case ">":
+		return xf > yf, nil
+	case ">=":
+		return xf >= yf, nil
+	}
+	return nil, e.errorf(n.At, "operator %v not defined for %v and %v", n.Op, typeOf(x), typeOf(y))
+}
+
+// equal compares two values, ints and floats compare by their numeric value
+func equal(x, y interface{}) bool {
+	if typeOf(x).isNumeric() && typeOf(y).isNumeric() {
+		return toFloat(x) == toFloat(y)
+	}
+	return x == y
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return math.NaN()
+}
+
+// Normalize converts a Go value into one of the value types of the expression
+// engine: int, float64, string or bool. Other numeric kinds and named types
+// are converted, false is returned for values that can't be used.
+func Normalize(v interface{}) (interface{}, bool) {
+	switch v.(type) {
+	case int, float64, string, bool:
+		return v, true
+	case nil:
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return rv.Bool(), true
+	}
+	return nil, false
+}
+
+// formatValue converts a value into its text form for error messages and String
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return fmt.Sprint(v)
+}
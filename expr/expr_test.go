@@ -0,0 +1,197 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/derlinkshaender/cmdparser"
+)
+
+func TestParseAndEval(t *testing.T) {
+	vars := Vars{"size": 12, "name": "board", "price": 2.5, "active": true}
+	data := []struct {
+		Source string
+		Tree   string
+		Result interface{}
+	}{
+		{Source: `4*(5+6) < 17`, Tree: `((4 * (5 + 6)) < 17)`, Result: false},
+		{Source: `size % 5 + 1`, Tree: `((size % 5) + 1)`, Result: 3},
+		{Source: `price * 2`, Tree: `(price * 2)`, Result: 5.0},
+		{Source: `name = "board" and not active`, Tree: `((name == "board") && (! active))`, Result: false},
+		{Source: `size > 10 || len(name) > 100`, Tree: `((size > 10) || (len(name) > 100))`, Result: true},
+		{Source: `upper(name) + '-' + "x"`, Tree: `((upper(name) + "-") + "x")`, Result: "BOARD-x"},
+		{Source: `contains(name, "oar") && -size < 0`, Tree: `(contains(name, "oar") && ((- size) < 0))`, Result: true},
+		{Source: `size == 12.0`, Tree: `(size == 12)`, Result: true},
+	}
+	for _, entry := range data {
+		e, err := Parse(entry.Source)
+		if err != nil {
+			t.Error("Parse failed for " + entry.Source + ": " + err.Error())
+			continue
+		}
+		if e.String() != entry.Tree {
+			t.Error("Unexpected tree " + e.String() + " for " + entry.Source)
+		}
+		if _, err := e.Check(TypesOf(vars)); err != nil {
+			t.Error("Check failed for " + entry.Source + ": " + err.Error())
+		}
+		val, err := e.Eval(vars)
+		if err != nil || val != entry.Result {
+			t.Errorf("Eval of %s returned %v, %v", entry.Source, val, err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	vars := Vars{"size": 12, "name": "board"}
+	data := []struct {
+		Source string
+		Column int
+	}{
+		{Source: `size + `, Column: 8},
+		{Source: `(size + 1`, Column: 10},
+		{Source: `name * 2`, Column: 6},
+		{Source: `colour == "red"`, Column: 1},
+		{Source: `size < "ten"`, Column: 6},
+		{Source: `foo(size)`, Column: 1},
+		{Source: `"open`, Column: 1},
+	}
+	for _, entry := range data {
+		e, err := Parse(entry.Source)
+		if err == nil {
+			_, err = e.Check(TypesOf(vars))
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) {
+			t.Error("Expected an error for " + entry.Source)
+			continue
+		}
+		if exprErr.Position.Column != entry.Column {
+			t.Errorf("Error %q for %s at column %d, expected %d", err, entry.Source, exprErr.Position.Column, entry.Column)
+		}
+	}
+	e, _ := Parse(`size / (size - 12)`)
+	if _, err := e.Eval(vars); err == nil {
+		t.Error("Expected division by zero error")
+	}
+}
+
+func TestUserFuncResults(t *testing.T) {
+	Funcs["big"] = &Func{Result: IntType, Fn: func(args []interface{}) (interface{}, error) {
+		return int64(3), nil
+	}}
+	Funcs["bad"] = &Func{Result: IntType, Fn: func(args []interface{}) (interface{}, error) {
+		return []int{3}, nil
+	}}
+	defer delete(Funcs, "big")
+	defer delete(Funcs, "bad")
+	for source, result := range map[string]interface{}{`big() < 4`: true, `big() * 2`: 6, `big() == 3`: true} {
+		e, _ := Parse(source)
+		val, err := e.Eval(Vars{})
+		if err != nil || val != result {
+			t.Errorf("Eval of %s returned %v, %v", source, val, err)
+		}
+	}
+	e, _ := Parse(`bad() < 4`)
+	var exprErr *Error
+	if _, err := e.Eval(Vars{}); !errors.As(err, &exprErr) {
+		t.Error("Expected an error for an unsupported function result")
+	}
+}
+
+func TestFromToken(t *testing.T) {
+	p := cmdparser.NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START":       ` "list" Item WhereClause?`,
+		"Item":        ` "card" | "board" | "list" `,
+		"WhereClause": ` "where" !expression `,
+	})
+	p.SetInputString(`list board where 'size > 10 and name = "x" +' `)
+	if !p.Parse() {
+		t.Fatal("Should match input string, but does not!")
+	}
+	_, err := FromToken(p.ParseResult["whereclause_expression"])
+	var exprErr *Error
+	if !errors.As(err, &exprErr) || exprErr.Position.Column != 45 {
+		t.Errorf("Expected error at column 45 of the command line, got %v", err)
+	}
+}
+
+type owner struct {
+	Name string
+}
+
+type board struct {
+	Title    string `expr:"name"`
+	Cards    int
+	Archived bool
+	Owner    *owner
+	internal int
+}
+
+func TestPredicate(t *testing.T) {
+	p := cmdparser.NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "list" "board" "where" !expression `,
+	})
+	p.SetInputString(`list board where 'cards > 2 and not archived and owner.name = "kim"' `)
+	if !p.Parse() {
+		t.Fatal("Should match input string, but does not!")
+	}
+	pred, err := Compile(p.ParseResult["start_expression"], board{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boards := []*board{
+		{Title: "todo", Cards: 5, Owner: &owner{Name: "kim"}},
+		{Title: "done", Cards: 9, Archived: true, Owner: &owner{Name: "kim"}},
+		{Title: "ideas", Cards: 1, Owner: &owner{Name: "kim"}},
+		{Title: "misc", Cards: 3, Owner: &owner{Name: "lee"}},
+	}
+	found := []string{}
+	for _, b := range boards {
+		ok, err := pred(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			found = append(found, b.Title)
+		}
+	}
+	if len(found) != 1 || found[0] != "todo" {
+		t.Errorf("Unexpected filter result %v", found)
+	}
+
+	e, _ := Parse(`name == "x" && size > 1`)
+	pred, err = e.Predicate(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := pred(map[string]interface{}{"name": "x", "size": int64(4)})
+	if !ok || err != nil {
+		t.Errorf("Map predicate returned %v, %v", ok, err)
+	}
+}
+
+func TestPredicateErrors(t *testing.T) {
+	data := []struct {
+		Source string
+		Column int
+	}{
+		{Source: `cards > 2 and colour == "red"`, Column: 15},
+		{Source: `title == "x"`, Column: 1},
+		{Source: `internal > 0`, Column: 1},
+		{Source: `owner > 0`, Column: 1},
+		{Source: `cards + 1`, Column: 1},
+	}
+	for _, entry := range data {
+		e, err := Parse(entry.Source)
+		if err == nil {
+			_, err = e.Predicate(board{})
+		}
+		var exprErr *Error
+		if !errors.As(err, &exprErr) || exprErr.Position.Column != entry.Column {
+			t.Errorf("Unexpected error %v for %s", err, entry.Source)
+		}
+	}
+}
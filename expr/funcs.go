@@ -0,0 +1,60 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Func describes a function that can be called in an expression
+type Func struct {
+	Args   []Type
+	Result Type
+	Fn     func(args []interface{}) (interface{}, error)
+}
+
+// Funcs is the function table used by Check and Eval. Add entries to make
+// your own functions available to all expressions.
+var Funcs = map[string]*Func{
+	"len": {Args: []Type{StringType}, Result: IntType, Fn: func(args []interface{}) (interface{}, error) {
+		return len([]rune(args[0].(string))), nil
+	}},
+	"lower": {Args: []Type{StringType}, Result: StringType, Fn: func(args []interface{}) (interface{}, error) {
+		return strings.ToLower(args[0].(string)), nil
+	}},
+	"upper": {Args: []Type{StringType}, Result: StringType, Fn: func(args []interface{}) (interface{}, error) {
+		return strings.ToUpper(args[0].(string)), nil
+	}},
+	"trim": {Args: []Type{StringType}, Result: StringType, Fn: func(args []interface{}) (interface{}, error) {
+		return strings.TrimSpace(args[0].(string)), nil
+	}},
+	"contains": {Args: []Type{StringType, StringType}, Result: BoolType, Fn: func(args []interface{}) (interface{}, error) {
+		return strings.Contains(args[0].(string), args[1].(string)), nil
+	}},
+	"startswith": {Args: []Type{StringType, StringType}, Result: BoolType, Fn: func(args []interface{}) (interface{}, error) {
+		return strings.HasPrefix(args[0].(string), args[1].(string)), nil
+	}},
+	"endswith": {Args: []Type{StringType, StringType}, Result: BoolType, Fn: func(args []interface{}) (interface{}, error) {
+		return strings.HasSuffix(args[0].(string), args[1].(string)), nil
+	}},
+	"matches": {Args: []Type{StringType, StringType}, Result: BoolType, Fn: func(args []interface{}) (interface{}, error) {
+		return regexp.MatchString(args[1].(string), args[0].(string))
+	}},
+	"abs": {Args: []Type{FloatType}, Result: FloatType, Fn: func(args []interface{}) (interface{}, error) {
+		return math.Abs(toFloat(args[0])), nil
+	}},
+	"min": {Args: []Type{FloatType, FloatType}, Result: FloatType, Fn: func(args []interface{}) (interface{}, error) {
+		return math.Min(toFloat(args[0]), toFloat(args[1])), nil
+	}},
+	"max": {Args: []Type{FloatType, FloatType}, Result: FloatType, Fn: func(args []interface{}) (interface{}, error) {
+		return math.Max(toFloat(args[0]), toFloat(args[1])), nil
+	}},
+	"int": {Args: []Type{FloatType}, Result: IntType, Fn: func(args []interface{}) (interface{}, error) {
+		f := toFloat(args[0])
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("value out of range")
+		}
+		return int(f), nil
+	}},
+}
@@ -0,0 +1,368 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/derlinkshaender/cmdparser"
+)
+
+// the kinds of lexical tokens of the expression language
+const (
+	lexEOF = iota
+	lexLiteral
+	lexString
+	lexIdent
+	lexOperator
+)
+
+// lexeme is a token of the expression language
+type lexeme struct {
+	kind  int
+	text  string
+	value interface{}
+	at    int
+}
+
+// Expression is a parsed expression together with its source
+type Expression struct {
+	Source string
+	Root   Node
+	base   scanner.Position
+	offset int
+}
+
+// operators, longest first so the lexer finds "<=" before "<"
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "=", "+", "-", "*", "/", "%", "!", "(", ")", ","}
+
+// keywords that are operators or literals instead of identifiers
+var keywords = map[string]string{
+	"and":   "&&",
+	"or":    "||",
+	"not":   "!",
+	"true":  "true",
+	"false": "false",
+}
+
+// Parse creates the AST for an expression string
+func Parse(source string) (*Expression, error) {
+	e := &Expression{Source: source, base: scanner.Position{Line: 1, Column: 1}}
+	return e, e.parse()
+}
+
+// FromToken parses the text of a cmdparser expression token. Errors refer to
+// the position of the expression inside the command line.
+func FromToken(tok cmdparser.CmdToken) (*Expression, error) {
+	e := &Expression{Source: tok.Text, base: tok.Position, offset: 1}
+	if tok.Type != cmdparser.TokenExpr {
+		return e, e.errorf(0, "token is not an expression")
+	}
+	return e, e.parse()
+}
+
+// String to implement Stringer interface for the Expression
+func (e *Expression) String() string {
+	if e.Root == nil {
+		return ""
+	}
+	return e.Root.String()
+}
+
+// errorf creates an error for the byte offset at inside the expression source
+func (e *Expression) errorf(at int, msg string, args ...interface{}) *Error {
+	pos := e.base
+	if at > len(e.Source) {
+		at = len(e.Source)
+	}
+	pos.Offset += e.offset + at
+	pos.Column += e.offset + utf8.RuneCountInString(e.Source[:at])
+	return &Error{Position: pos, Msg: fmt.Sprintf(msg, args...)}
+}
+
+func (e *Expression) parse() error {
+	lexemes, err := e.lex()
+	if err != nil {
+		return err
+	}
+	p := &exprParser{expr: e, lexemes: lexemes}
+	e.Root, err = p.parseOr()
+	if err == nil && p.peek().kind != lexEOF {
+		err = e.errorf(p.peek().at, "unexpected %v", p.peek().text)
+	}
+	if err != nil {
+		e.Root = nil
+	}
+	return err
+}
+
+// lex splits the expression source into lexemes
+func (e *Expression) lex() ([]lexeme, error) {
+	result := []lexeme{}
+	src := e.Source
+	i := 0
+	for i < len(src) {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start := i
+			isFloat := false
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				(src[i] == '-' || src[i] == '+') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				isFloat = isFloat || src[i] == '.' || src[i] == 'e' || src[i] == 'E'
+				i++
+			}
+			text := src[start:i]
+			lex := lexeme{kind: lexLiteral, text: text, at: start}
+			var err error
+			if isFloat {
+				lex.value, err = strconv.ParseFloat(text, 64)
+			} else {
+				lex.value, err = strconv.Atoi(text)
+			}
+			if err != nil {
+				return nil, e.errorf(start, "invalid number %v", text)
+			}
+			result = append(result, lex)
+		case r == '"' || r == '\'':
+			start := i
+			str, end, ok := unquote(src, i)
+			if !ok {
+				return nil, e.errorf(start, "unterminated string")
+			}
+			i = end
+			result = append(result, lexeme{kind: lexString, text: src[start:i], value: str, at: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) {
+				r, size = utf8.DecodeRuneInString(src[i:])
+				if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				i += size
+			}
+			text := src[start:i]
+			if op, ok := keywords[strings.ToLower(text)]; ok {
+				if op == "true" || op == "false" {
+					result = append(result, lexeme{kind: lexLiteral, text: op, value: op == "true", at: start})
+				} else {
+					result = append(result, lexeme{kind: lexOperator, text: op, at: start})
+				}
+			} else {
+				result = append(result, lexeme{kind: lexIdent, text: text, at: start})
+			}
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					result = append(result, lexeme{kind: lexOperator, text: op, at: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, e.errorf(i, "unexpected character %v", string(r))
+			}
+		}
+	}
+	return append(result, lexeme{kind: lexEOF, text: "end of expression", at: len(src)}), nil
+}
+
+// unquote reads the string literal starting at src[start]. Both quote characters
+// can be used, the escapes are the ones known from Go strings.
+func unquote(src string, start int) (string, int, bool) {
+	quote := src[start]
+	var sb strings.Builder
+	i := start + 1
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == quote:
+			return sb.String(), i + 1, true
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(src[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+		i++
+	}
+	return "", i, false
+}
+
+// exprParser is a recursive descent parser for the lexemes of an expression
+type exprParser struct {
+	expr    *Expression
+	lexemes []lexeme
+	index   int
+}
+
+func (p *exprParser) peek() lexeme {
+	return p.lexemes[p.index]
+}
+
+func (p *exprParser) next() lexeme {
+	lex := p.lexemes[p.index]
+	if lex.kind != lexEOF {
+		p.index++
+	}
+	return lex
+}
+
+// accept consumes the next lexeme if it is one of the given operators
+func (p *exprParser) accept(ops ...string) (lexeme, bool) {
+	lex := p.peek()
+	if lex.kind == lexOperator {
+		for _, op := range ops {
+			if lex.text == op {
+				p.index++
+				return lex, true
+			}
+		}
+	}
+	return lex, false
+}
+
+func (p *exprParser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	for err == nil {
+		op, ok := p.accept("||")
+		if !ok {
+			break
+		}
+		var right Node
+		right, err = p.parseAnd()
+		left = &Binary{At: op.at, Op: op.text, X: left, Y: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	for err == nil {
+		op, ok := p.accept("&&")
+		if !ok {
+			break
+		}
+		var right Node
+		right, err = p.parseNot()
+		left = &Binary{At: op.at, Op: op.text, X: left, Y: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseNot() (Node, error) {
+	if op, ok := p.accept("!"); ok {
+		x, err := p.parseNot()
+		return &Unary{At: op.at, Op: op.text, X: x}, err
+	}
+	return p.parseComparison()
+}
+
+// comparisons do not chain, "a < b < c" is a syntax error
+func (p *exprParser) parseComparison() (Node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return left, err
+	}
+	if op, ok := p.accept("==", "=", "!=", "<", "<=", ">", ">="); ok {
+		if op.text == "=" {
+			op.text = "=="
+		}
+		var right Node
+		right, err = p.parseAdditive()
+		left = &Binary{At: op.at, Op: op.text, X: left, Y: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseAdditive() (Node, error) {
+	left, err := p.parseMultiplicative()
+	for err == nil {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			break
+		}
+		var right Node
+		right, err = p.parseMultiplicative()
+		left = &Binary{At: op.at, Op: op.text, X: left, Y: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseMultiplicative() (Node, error) {
+	left, err := p.parseUnary()
+	for err == nil {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			break
+		}
+		var right Node
+		right, err = p.parseUnary()
+		left = &Binary{At: op.at, Op: op.text, X: left, Y: right}
+	}
+	return left, err
+}
+
+func (p *exprParser) parseUnary() (Node, error) {
+	if op, ok := p.accept("-", "+"); ok {
+		x, err := p.parseUnary()
+		return &Unary{At: op.at, Op: op.text, X: x}, err
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Node, error) {
+	lex := p.next()
+	switch lex.kind {
+	case lexLiteral, lexString:
+		return &Literal{At: lex.at, Value: lex.value}, nil
+	case lexIdent:
+		if _, ok := p.accept("("); !ok {
+			return &Ident{At: lex.at, Name: lex.text}, nil
+		}
+		call := &Call{At: lex.at, Name: strings.ToLower(lex.text)}
+		if _, ok := p.accept(")"); ok {
+			return call, nil
+		}
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return call, err
+			}
+			call.Args = append(call.Args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if _, ok := p.accept(")"); !ok {
+			return call, p.expr.errorf(p.peek().at, "expected ) instead of %v", p.peek().text)
+		}
+		return call, nil
+	case lexOperator:
+		if lex.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return x, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return x, p.expr.errorf(p.peek().at, "expected ) instead of %v", p.peek().text)
+			}
+			return x, nil
+		}
+	}
+	return nil, p.expr.errorf(lex.at, "unexpected %v", lex.text)
+}
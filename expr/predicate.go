@@ -0,0 +1,191 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/derlinkshaender/cmdparser"
+)
+
+// Predicate is a compiled expression that filters Go values
+type Predicate func(v interface{}) (bool, error)
+
+// Compile creates a predicate from an expression token. The identifiers are
+// resolved against the fields of sample, which is a struct, a pointer to a
+// struct or a map with string keys. Struct fields are matched by their `expr`
+// tag or case-insensitive by name, nested fields are written as "a.b".
+// Unknown fields are reported at their position in the command line.
+func Compile(tok cmdparser.CmdToken, sample interface{}) (Predicate, error) {
+	e, err := FromToken(tok)
+	if err != nil {
+		return nil, err
+	}
+	return e.Predicate(sample)
+}
+
+// Predicate compiles the expression into a predicate for values of the same type as sample
+func (e *Expression) Predicate(sample interface{}) (Predicate, error) {
+	if e.Root == nil {
+		return nil, e.errorf(0, "empty expression")
+	}
+	sampleType := reflect.TypeOf(sample)
+	if sampleType == nil {
+		return nil, e.errorf(0, "predicate needs a sample value")
+	}
+	types := Types{}
+	var err error
+	walk(e.Root, func(ident *Ident) {
+		if err != nil {
+			return
+		}
+		t, ok := typeOfPath(sampleType, strings.Split(ident.Name, "."))
+		if !ok {
+			err = e.errorf(ident.At, "unknown field %v in %v", ident.Name, sampleType)
+		}
+		types[ident.Name] = t
+	})
+	if err != nil {
+		return nil, err
+	}
+	result, err := e.Check(types)
+	if err != nil {
+		return nil, err
+	}
+	if result != BoolType && result != AnyType {
+		return nil, e.errorf(0, "expression is %v, not bool", result)
+	}
+	return func(v interface{}) (bool, error) {
+		return e.EvalBool(&valueResolver{value: reflect.ValueOf(v)})
+	}, nil
+}
+
+// walk calls fn for every identifier of the AST
+func walk(node Node, fn func(*Ident)) {
+	switch n := node.(type) {
+	case *Ident:
+		fn(n)
+	case *Unary:
+		walk(n.X, fn)
+	case *Binary:
+		walk(n.X, fn)
+		walk(n.Y, fn)
+	case *Call:
+		for _, arg := range n.Args {
+			walk(arg, fn)
+		}
+	}
+}
+
+// typeOfPath returns the expression type of a field path, false if a field is unknown.
+// Map entries can only be checked at run-time.
+func typeOfPath(t reflect.Type, path []string) (Type, bool) {
+	for len(path) > 0 {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := findField(t, path[0])
+			if !ok {
+				return AnyType, false
+			}
+			t = field.Type
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return AnyType, false
+			}
+			t = t.Elem()
+		case reflect.Interface:
+			return AnyType, true
+		default:
+			return AnyType, false
+		}
+		path = path[1:]
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return IntType, true
+	case reflect.Float32, reflect.Float64:
+		return FloatType, true
+	case reflect.String:
+		return StringType, true
+	case reflect.Bool:
+		return BoolType, true
+	case reflect.Interface:
+		return AnyType, true
+	}
+	// structs, slices and the like can't be used as values
+	return AnyType, false
+}
+
+// findField looks up an exported struct field by its expr tag or by its name
+func findField(t reflect.Type, name string) (reflect.StructField, bool) {
+	var byName *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("expr")
+		if tag == "-" {
+			continue
+		}
+		if tag == name {
+			return field, true
+		}
+		if tag == "" && byName == nil && strings.EqualFold(field.Name, name) {
+			byName = &field
+		}
+	}
+	if byName != nil {
+		return *byName, true
+	}
+	return reflect.StructField{}, false
+}
+
+// valueResolver resolves identifiers against the fields of a Go value
+type valueResolver struct {
+	value reflect.Value
+}
+
+// Resolve to implement the Resolver interface for the valueResolver
+func (r *valueResolver) Resolve(name string) (interface{}, bool) {
+	v := r.value
+	for _, part := range strings.Split(name, ".") {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := findField(v.Type(), part)
+			if !ok {
+				return nil, false
+			}
+			v = v.FieldByIndex(field.Index)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			v = v.MapIndex(reflect.ValueOf(part).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	return v.Interface(), true
+}
@@ -0,0 +1,158 @@
+package expr
+
+import (
+	"strconv"
+	"text/scanner"
+)
+
+// Type is the static type of an expression node
+type Type int
+
+// the types known to the expression engine
+const (
+	AnyType Type = iota // type is only known at run-time
+	IntType
+	FloatType
+	StringType
+	BoolType
+)
+
+// String to implement Stringer interface for the Type
+func (t Type) String() string {
+	switch t {
+	case IntType:
+		return "int"
+	case FloatType:
+		return "float"
+	case StringType:
+		return "string"
+	case BoolType:
+		return "bool"
+	}
+	return "any"
+}
+
+// isNumeric reports if values of this type can be used in arithmetic
+func (t Type) isNumeric() bool {
+	return t == IntType || t == FloatType || t == AnyType
+}
+
+// Node is the interface for all nodes of the expression AST
+type Node interface {
+	// Pos returns the byte offset of the node in the expression source
+	Pos() int
+	String() string
+}
+
+// Literal is a constant int, float64, string or bool value
+type Literal struct {
+	At    int
+	Value interface{}
+}
+
+// Ident references a variable, nested fields are separated with dots
+type Ident struct {
+	At   int
+	Name string
+}
+
+// Unary is an operator with one operand, like "-" or "not"
+type Unary struct {
+	At int
+	Op string
+	X  Node
+}
+
+// Binary is an operator with two operands
+type Binary struct {
+	At int
+	Op string
+	X  Node
+	Y  Node
+}
+
+// Call is the call of a function from the function table
+type Call struct {
+	At   int
+	Name string
+	Args []Node
+}
+
+// Pos returns the offset of the literal
+func (n *Literal) Pos() int { return n.At }
+
+// Pos returns the offset of the identifier
+func (n *Ident) Pos() int { return n.At }
+
+// Pos returns the offset of the operator
+func (n *Unary) Pos() int { return n.At }
+
+// Pos returns the offset of the operator
+func (n *Binary) Pos() int { return n.At }
+
+// Pos returns the offset of the function name
+func (n *Call) Pos() int { return n.At }
+
+// String to implement Stringer interface for the Literal
+func (n *Literal) String() string {
+	if s, ok := n.Value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return formatValue(n.Value)
+}
+
+// String to implement Stringer interface for the Ident
+func (n *Ident) String() string {
+	return n.Name
+}
+
+// String to implement Stringer interface for the Unary
+func (n *Unary) String() string {
+	return "(" + n.Op + " " + n.X.String() + ")"
+}
+
+// String to implement Stringer interface for the Binary
+func (n *Binary) String() string {
+	return "(" + n.X.String() + " " + n.Op + " " + n.Y.String() + ")"
+}
+
+// String to implement Stringer interface for the Call
+func (n *Call) String() string {
+	s := n.Name + "("
+	for i, arg := range n.Args {
+		if i > 0 {
+			s += ", "
+		}
+		s += arg.String()
+	}
+	return s + ")"
+}
+
+// Error is returned for syntax, type and evaluation errors. The position
+// refers to the command line if the expression was created from a token.
+type Error struct {
+	Position scanner.Position
+	Msg      string
+}
+
+// Error to implement the error interface for the Error
+func (e *Error) Error() string {
+	return e.Msg + " at col " + strconv.Itoa(e.Position.Column)
+}
+
+// Resolver looks up the value of a variable used in an expression
+type Resolver interface {
+	Resolve(name string) (interface{}, bool)
+}
+
+// Vars is a Resolver for a simple map of variable values
+type Vars map[string]interface{}
+
+// Resolve to implement the Resolver interface for Vars
+func (v Vars) Resolve(name string) (interface{}, bool) {
+	val, ok := v[name]
+	return val, ok
+}
+
+// Types maps variable names to their static types for Check
+type Types map[string]Type
@@ -0,0 +1,144 @@
+package cmdparser
+
+// commandGrammar is a realistic grammar of 50 commands of an admin shell, it is
+// used by the benchmarks and to check that large grammars keep working
+var commandGrammar = map[string]string{
+	"START": `Command`,
+	"Command": `ShowFeature | ShowTable | ShowUsers | ShowGroups | ShowConfig | ShowLog |
+		ListTables | ListJobs | ListFiles | ListSessions |
+		CreateTable | CreateUser | CreateGroup | CreateIndex | CreateJob |
+		DropTable | DropUser | DropGroup | DropIndex | DropJob |
+		AlterTable | RenameTable | GrantRole | RevokeRole | SetOption |
+		UnsetOption | Export | Import | Backup | Restore |
+		Select | Insert | Update | Delete | Count |
+		StartJob | StopJob | PauseJob | ResumeJob | Schedule |
+		Connect | Disconnect | Use | Describe | Explain |
+		Translate | Sync | Purge | Help | Quit`,
+
+	"ShowFeature": `"show" "feature" !string? LangList? ToClause?`,
+	"ShowTable":   `"show" "table" !ident Options`,
+	"ShowUsers":   `"show" "users" Filter?`,
+	"ShowGroups":  `"show" "groups" Filter?`,
+	"ShowConfig":  `"show" "config" !ident?`,
+	"ShowLog":     `"show" "log" LimitClause? "follow"?`,
+
+	"ListTables":   `"list" "tables" Options`,
+	"ListJobs":     `"list" "jobs" ("running" | "failed" | "done")?`,
+	"ListFiles":    `"list" "files" !string?`,
+	"ListSessions": `"list" "sessions" "all"?`,
+
+	"CreateTable": `"create" "table" !ident '(' ColumnDef % ',' ')'`,
+	"CreateUser":  `"create" "user" !ident ("password" !string)? ("in" "group" !ident)?`,
+	"CreateGroup": `"create" "group" !ident`,
+	"CreateIndex": `"create" "unique"? "index" !ident "on" !ident '(' !ident % ',' ')'`,
+	"CreateJob":   `"create" "job" !ident "run" !string ScheduleClause?`,
+
+	"DropTable": `"drop" "table" !ident % ',' "cascade"?`,
+	"DropUser":  `"drop" "user" !ident`,
+	"DropGroup": `"drop" "group" !ident`,
+	"DropIndex": `"drop" "index" !ident`,
+	"DropJob":   `"drop" "job" !ident`,
+
+	"AlterTable":  `"alter" "table" !ident AlterAction`,
+	"AlterAction": `"add" "column" ColumnDef | "drop" "column" !ident | "rename" "column" !ident "to" !ident`,
+	"RenameTable": `"rename" "table" !ident "to" !ident`,
+	"GrantRole":   `"grant" !ident % ',' "to" !ident`,
+	"RevokeRole":  `"revoke" !ident % ',' "from" !ident`,
+	"SetOption":   `"set" !ident '=' Value`,
+
+	"UnsetOption": `"unset" !ident`,
+	"Export":      `"export" !ident ToClause ("format" ("csv" | "json"))?`,
+	"Import":      `"import" !ident "from" !string ("format" ("csv" | "json"))?`,
+	"Backup":      `"backup" ("database" | "table" !ident) ToClause`,
+	"Restore":     `"restore" !string ("into" !ident)?`,
+
+	"Select": `"select" Columns "from" !ident Filter? OrderClause? LimitClause?`,
+	"Insert": `"insert" "into" !ident "values" '(' Value % ',' ')'`,
+	"Update": `"update" !ident "set" Assignment % ',' Filter?`,
+	"Delete": `"delete" "from" !ident Filter`,
+	"Count":  `"count" !ident Filter?`,
+
+	"StartJob":  `"start" "job" !ident`,
+	"StopJob":   `"stop" "job" !ident "force"?`,
+	"PauseJob":  `"pause" "job" !ident`,
+	"ResumeJob": `"resume" "job" !ident`,
+	"Schedule":  `"schedule" !ident ScheduleClause`,
+
+	"Connect":    `"connect" !string ("as" !ident)?`,
+	"Disconnect": `"disconnect"`,
+	"Use":        `"use" !ident`,
+	"Describe":   `"describe" !ident`,
+	"Explain":    `"explain" Select`,
+
+	"Translate": `"translate" !string LangList`,
+	"Sync":      `"sync" ("from" !string)? ("to" !string)?`,
+	"Purge":     `"purge" ("logs" | "cache" | "trash") ("older" "than" !int "days")?`,
+	"Help":      `"help" !ident?`,
+	"Quit":      `"quit" | "exit"`,
+
+	"Options":        `LimitClause? & OrderClause? & Filter?`,
+	"Filter":         `"where" !expression`,
+	"LimitClause":    `"limit" !int`,
+	"OrderClause":    `"order" "by" !ident ("asc" | "desc")?`,
+	"ToClause":       `"to" !string`,
+	"LangList":       `"lang" !string % ','`,
+	"ColumnDef":      `!ident ("int" | "text" | "float" | "bool") "null"?`,
+	"Columns":        `'*' | !ident % ','`,
+	"Assignment":     `!ident '=' Value`,
+	"Value":          `!string | !int | !float | !bool`,
+	"ScheduleClause": `"every" !int ("minutes" | "hours" | "days")`,
+}
+
+// commandInputs are valid inputs for the commands of commandGrammar
+var commandInputs = []string{
+	`show feature "de" lang "de", "it" to "/tmp/de.csv"`,
+	`show table users limit 10 order by name desc`,
+	`show users where 'age > 30'`,
+	`show groups`,
+	`show config timeout`,
+	`show log limit 100 follow`,
+	`list tables where 'size > 1000' limit 5`,
+	`list jobs failed`,
+	`list files "/var/log"`,
+	`list sessions all`,
+	`create table users (id int, name text null, score float)`,
+	`create user alice password "secret" in group admins`,
+	`create group admins`,
+	`create unique index idx_name on users (name, id)`,
+	`create job cleanup run "purge trash" every 2 hours`,
+	`drop table logs, audit cascade`,
+	`drop user bob`,
+	`drop group guests`,
+	`drop index idx_name`,
+	`drop job cleanup`,
+	`alter table users add column email text`,
+	`rename table users to members`,
+	`grant reader, writer to alice`,
+	`revoke writer from bob`,
+	`set timeout = 30`,
+	`unset timeout`,
+	`export users to "/tmp/users.json" format json`,
+	`import users from "/tmp/users.csv" format csv`,
+	`backup table users to "/backup/users"`,
+	`restore "/backup/users" into users`,
+	`select id, name from users where 'age > 18' order by name limit 20`,
+	`insert into users values ("carol", 42, 1.5, true)`,
+	`update users set name = "dave", score = 3.5 where 'id = 7'`,
+	`delete from users where 'id = 7'`,
+	`count users`,
+	`start job cleanup`,
+	`stop job cleanup force`,
+	`pause job cleanup`,
+	`resume job cleanup`,
+	`schedule cleanup every 30 minutes`,
+	`connect "db.example.com" as admin`,
+	`disconnect`,
+	`use production`,
+	`describe users`,
+	`explain select * from users`,
+	`translate "hello" lang "de", "fr"`,
+	`sync from "/data" to "/backup"`,
+	`purge logs older than 30 days`,
+	`help select`,
+	`quit`,
+}
@@ -0,0 +1,276 @@
+package cmdparser
+
+import (
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseArgs parses pre-split command line arguments like os.Args[1:]. The
+// arguments are not tokenized again, so blanks inside an argument are kept.
+// Arguments starting with "-" or "--" are flags, "--name=value" and "-abc"
+// (combined short flags) are split up, "--" ends the flags.
+func (theParser *CommandParser) ParseArgs(args []string) bool {
+	tokenizer, ok := theParser.tokenizer.(*DefaultTokenizer)
+	if !ok {
+		// the bool words of a custom tokenizer are unknown
+		tokenizer = NewDefaultTokenizer()
+	}
+	theParser.SetTokens(tokenizer.argsToTokens(args))
+	theParser.argsMode = true
+	defer func() { theParser.argsMode = false }()
+	return theParser.Parse()
+}
+
+// argsToTokens converts the arguments into tokens, the column of a token
+// is the number of its argument
+func (theTokenizer *DefaultTokenizer) argsToTokens(args []string) []*CmdToken {
+	result := []*CmdToken{}
+	flagsDone := false
+	for i, arg := range args {
+		pos := scanner.Position{Filename: "args", Offset: i, Line: 1, Column: i + 1}
+		switch {
+		case flagsDone:
+			result = append(result, theTokenizer.argToken(arg, pos))
+		case arg == "--":
+			flagsDone = true
+		case isFlag(arg):
+			result = append(result, theTokenizer.flagTokens(arg, pos)...)
+		default:
+			result = append(result, theTokenizer.argToken(arg, pos))
+		}
+	}
+	return result
+}
+
+// isFlag reports if an argument is a flag, negative numbers are not
+func isFlag(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(strings.TrimLeft(arg, "-"))
+	return unicode.IsLetter(r)
+}
+
+// argToken creates the token for a plain argument
+func (theTokenizer *DefaultTokenizer) argToken(arg string, pos scanner.Position) *CmdToken {
+	token := &CmdToken{Type: TokenString, Text: arg, Value: arg, Position: pos, End: pos}
+	token.End.Offset++
+	token.End.Column++
+	if val, err := strconv.Atoi(arg); err == nil {
+		token.Type = TokenInt
+		token.Value = val
+	} else if val, err := strconv.ParseFloat(arg, 64); err == nil {
+		token.Type = TokenFloat
+		token.Value = val
+	} else if isIdentifier(arg) {
+		if boolTok, _ := theTokenizer.tokenFromIdentifier(&PreToken{Text: arg}); boolTok.Type == TokenBool {
+			token.Type = TokenBool
+			token.Value = boolTok.Value
+		} else {
+			token.Type = TokenIdent
+		}
+	}
+	return token
+}
+
+// isIdentifier reports if the text is an identifier for the go scanner
+func isIdentifier(text string) bool {
+	for i, r := range text {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return text != ""
+}
+
+// flagTokens creates the flag tokens for "--name", "--name=value", "-v", "-o=value"
+// and combined short flags like "-abc". The value of an attached value is a token.
+func (theTokenizer *DefaultTokenizer) flagTokens(arg string, pos scanner.Position) []*CmdToken {
+	name, value, hasValue := arg, "", false
+	if i := strings.Index(arg, "="); i > 0 {
+		name, value, hasValue = arg[:i], arg[i+1:], true
+	}
+	flag := &CmdToken{Type: TokenFlag, Text: name, Position: pos, End: pos}
+	if hasValue {
+		flag.Value = theTokenizer.argToken(value, pos)
+	}
+	return splitShortFlags(flag)
+}
+
+// splitShortFlags splits combined short flags like "-abc" into "-a", "-b" and "-c".
+// An attached value belongs to the last flag.
+func splitShortFlags(flag *CmdToken) []*CmdToken {
+	if strings.HasPrefix(flag.Text, "--") || utf8.RuneCountInString(flag.Text) == 2 {
+		return []*CmdToken{flag}
+	}
+	result := []*CmdToken{}
+	for _, r := range flag.Text[1:] {
+		result = append(result, &CmdToken{Type: TokenFlag, Text: "-" + string(r), Position: flag.Position, End: flag.End})
+	}
+	result[len(result)-1].Value = flag.Value
+	return result
+}
+
+// pushFlagScope makes the flags of a rule available while the rule is matched
+func (theParser *CommandParser) pushFlagScope(rule *RuleStruct) {
+	scope := &flagScope{rule: rule, start: len(theParser.captures)}
+	theParser.flagScopes = append(theParser.flagScopes, scope)
+}
+
+// popFlagScope removes the flags of the current rule and checks that the
+// required flags were given
+func (theParser *CommandParser) popFlagScope() bool {
+	scope := theParser.flagScopes[len(theParser.flagScopes)-1]
+	theParser.flagScopes = theParser.flagScopes[:len(theParser.flagScopes)-1]
+	result := true
+	for _, item := range scope.rule.Items {
+		if scope.rule.Type == Sequence && item.ExprType == FlagExpr && theParser.flagCount(scope, item) == 0 &&
+			(item.Cardinality == CardinalityOne || item.Cardinality == CardinalityOneOrMore) {
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: 0, Message: "Rule " + scope.rule.Name + ", missing flag " + item.ExprString})
+			result = false
+		}
+	}
+	return result
+}
+
+// matchFlags consumes the flags at the current position of the input. A flag
+// may belong to any rule that is currently matched. Returns false for a flag
+// without a matching value or a duplicate flag.
+func (theParser *CommandParser) matchFlags() bool {
+	for {
+		tok := theParser.peek()
+		if tok == nil || tok.Type != TokenFlag {
+			return true
+		}
+		scope, item := theParser.findFlag(tok.Text)
+		if item == nil {
+			// not a flag of the current rules, the grammar decides if this is ok
+			return true
+		}
+		pos := theParser.tokenPos
+		flag := theParser.read()
+		theParser.trace(TraceTryItem, item.ParentRule, item, pos, false)
+		if !theParser.matchFlag(scope, item, flag) {
+			theParser.trace(TraceFail, item.ParentRule, item, pos, false)
+			return false
+		}
+		theParser.trace(TraceMatch, item.ParentRule, item, pos, true)
+	}
+}
+
+// matchFlag captures a flag of the input and its value
+func (theParser *CommandParser) matchFlag(scope *flagScope, item *RuleItem, flag *CmdToken) bool {
+	if theParser.flagCount(scope, item) > 0 && (item.Cardinality == CardinalityOne || item.Cardinality == CardinalityZeroOrOne) {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: flag.Position.Column, Message: "Duplicate flag " + flag.Text})
+		return false
+	}
+	captured := copyToken(flag)
+	captured.Value = true
+	if item.FlagValue != "" {
+		valueTok, _ := flag.Value.(*CmdToken)
+		if valueTok == nil {
+			// the value is the next argument, as in "--name value"
+			valueTok = theParser.read()
+		}
+		if valueTok == nil || valueTok.Type == TokenFlag {
+			theParser.unread(valueTok)
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: flag.Position.Column, Message: "Missing value for flag " + flag.Text})
+			return false
+		}
+		matched, ok := theParser.matchDataType(item.FlagValue, valueTok)
+		if !ok {
+			theParser.errorList = append(theParser.errorList, &ParseError{Column: valueTok.Position.Column, Message: "Flag " + flag.Text + " expects " + item.FlagValue})
+			return false
+		}
+		captured.Value = matched.Value
+		captured.End = matched.End
+	}
+	theParser.capture(item, captured)
+	theParser.captures[len(theParser.captures)-1].scope = scope
+	return true
+}
+
+// flagCount returns how often a flag of a rule was given so far
+func (theParser *CommandParser) flagCount(scope *flagScope, item *RuleItem) int {
+	count := 0
+	for i := scope.start; i < len(theParser.captures); i++ {
+		if theParser.captures[i].scope == scope && theParser.captures[i].item == item {
+			count++
+		}
+	}
+	return count
+}
+
+// findFlag looks up a flag in the rules that are currently matched, innermost first
+func (theParser *CommandParser) findFlag(name string) (*flagScope, *RuleItem) {
+	for i := len(theParser.flagScopes) - 1; i >= 0; i-- {
+		scope := theParser.flagScopes[i]
+		if scope.rule.Type != Sequence {
+			continue
+		}
+		for _, item := range scope.rule.Items {
+			if item.ExprType == FlagExpr && item.ExprString == name {
+				return scope, item
+			}
+		}
+	}
+	return nil, nil
+}
+
+// follows reports if the token b starts right where the token a ends
+func follows(a, b *CmdToken) bool {
+	return b.Position.Line == a.End.Line && b.Position.Offset == a.End.Offset
+}
+
+// combineFlags merges the tokens of a flag in an input line, like "-" "-" "dry"
+// "-" "run", into flag tokens, so the grammar works for input lines and for
+// ParseArgs. A "-" directly after another token, as in "a-b", is not a flag.
+// The tokens are only combined for a grammar with flags.
+func combineFlags(tokens []*CmdToken) []*CmdToken {
+	result := []*CmdToken{}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		isDash := func(j int) bool {
+			return j < len(tokens) && tokens[j].Type == TokenChar && tokens[j].Text == "-" && follows(tokens[j-1], tokens[j])
+		}
+		if tok.Type != TokenChar || tok.Text != "-" || (i > 0 && follows(tokens[i-1], tok)) {
+			result = append(result, tok)
+			continue
+		}
+		// the dashes, then the name, hyphens are allowed in the name
+		j := i + 1
+		if isDash(j) {
+			j++
+		}
+		if j >= len(tokens) || !follows(tokens[j-1], tokens[j]) || (tokens[j].Type != TokenIdent && tokens[j].Type != TokenBool) {
+			result = append(result, tok)
+			continue
+		}
+		name := strings.Repeat("-", j-i)
+		for j < len(tokens) && follows(tokens[j-1], tokens[j]) && (tokens[j].Type == TokenIdent || tokens[j].Type == TokenBool || tokens[j].Type == TokenInt) {
+			name += tokens[j].Text
+			j++
+			if isDash(j) && j+1 < len(tokens) && follows(tokens[j], tokens[j+1]) && tokens[j+1].Type == TokenIdent {
+				name += "-"
+				j++
+			}
+		}
+		last := tokens[j-1]
+		var value *CmdToken
+		if j+1 < len(tokens) && tokens[j].Type == TokenChar && tokens[j].Text == "=" && follows(last, tokens[j]) && follows(tokens[j], tokens[j+1]) {
+			value = tokens[j+1]
+			last = value
+			j += 2
+		}
+		flag := &CmdToken{Type: TokenFlag, Text: name, Position: tok.Position, End: last.End}
+		if value != nil {
+			flag.Value = value
+		}
+		result = append(result, splitShortFlags(flag)...)
+		i = j - 1
+	}
+	return result
+}
@@ -0,0 +1,114 @@
+package cmdparser
+
+import "testing"
+
+var flagGrammar = map[string]string{
+	"START": `"copy" --verbose? -v? -q? --count=!int? --name=!string? !string+`,
+}
+
+func TestParseArgs(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(flagGrammar)
+
+	match := p.ParseArgs([]string{"copy", "--count=3", "my file.txt", "--name", "two words", "-vq"})
+	Assert(t, match, "Expected args to match")
+	Assert(t, p.ParseResult["start_count"].Value == 3, "Expected count 3")
+	Assert(t, p.ParseResult["start_name"].Value == "two words", "Expected blanks inside the name value")
+	Assert(t, p.ParseResult["start_v"].Value == true, "Expected -v from the combined flags")
+	Assert(t, p.ParseResult["start_q"].Value == true, "Expected -q from the combined flags")
+	Assert(t, p.ParseResult["start_string"].Value == "my file.txt", "Expected blanks inside the argument")
+	_, ok := p.ParseResult["start_verbose"]
+	Assert(t, !ok, "Expected no --verbose")
+
+	// any order, and "--" ends the flags
+	match = p.ParseArgs([]string{"--verbose", "copy", "42", "--", "--name"})
+	Assert(t, match, "Expected flags before the command to match")
+	Assert(t, p.ParseResult["start_verbose"].Value == true, "Expected --verbose")
+	Assert(t, p.ParseResult["start_string"].Value == "--name", "Expected -- to end the flags")
+
+	Assert(t, !p.ParseArgs([]string{"copy", "--count=x", "a"}), "Expected an invalid count to fail")
+	Assert(t, !p.ParseArgs([]string{"copy", "a", "--count"}), "Expected a missing value to fail")
+	Assert(t, !p.ParseArgs([]string{"copy", "-v", "a", "-v"}), "Expected a duplicate flag to fail")
+	Assert(t, !p.ParseArgs([]string{"copy", "--unknown", "a"}), "Expected an unknown flag to fail")
+}
+
+func TestRequiredFlags(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": `"deploy" --target=!string -f*`,
+	})
+	Assert(t, p.ParseArgs([]string{"deploy", "--target", "prod", "-f", "-f"}), "Expected repeated -f to match")
+	Assert(t, p.ParseResult["start_target"].Value == "prod", "Expected the target")
+	Assert(t, !p.ParseArgs([]string{"deploy", "-f"}), "Expected a missing required flag to fail")
+	found := false
+	for _, e := range p.Errors() {
+		found = found || e.Message == "Rule START, missing flag --target"
+	}
+	Assert(t, found, "Expected a missing flag error")
+}
+
+func TestFlagsInInputLine(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(flagGrammar)
+	p.SetInputString(`copy --count=3 -vq --name "two words" "my file.txt"`)
+	Assert(t, p.Parse(), "Expected the input line to match")
+	Assert(t, p.ParseResult["start_count"].Value == 3, "Expected count 3")
+	Assert(t, p.ParseResult["start_name"].Value == "two words", "Expected the name")
+	Assert(t, p.ParseResult["start_q"].Value == true, "Expected -q")
+
+	p.SetCommandGrammar(map[string]string{"START": `"run" --dry-run? !int`})
+	p.SetInputString(`run --dry-run 5`)
+	Assert(t, p.Parse(), "Expected a hyphenated flag to match")
+	Assert(t, p.ParseResult["start_dry-run"].Value == true, "Expected --dry-run")
+}
+
+func TestInputBeforeFlagGrammar(t *testing.T) {
+	p := NewParser()
+	p.SetInputString(`copy --count=5 "a"`)
+	p.SetCommandGrammar(flagGrammar)
+	Assert(t, p.Parse(), "Expected the input set before the grammar to match")
+	Assert(t, p.ParseResult["start_count"].Value == 5, "Expected count 5")
+
+	p = NewParser()
+	p.SetCommandGrammar(flagGrammar)
+	p.SetInputString(`range -foo`)
+	p.SetCommandGrammar(map[string]string{"START": `"range" '-' !ident`})
+	Assert(t, p.Parse(), "Expected the flags to be split again for a grammar without flags")
+}
+
+func TestNoFlagsWithoutFlagItems(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"range" '-' !ident`})
+	p.SetInputString(`range -foo`)
+	Assert(t, p.Parse(), "Expected '-' and an identifier without flags in the grammar")
+	Assert(t, p.ParseResult["start_ident"].Value == "foo", "Expected foo as identifier")
+}
+
+func TestFlagsOnBacktrack(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START":  `"run" -v? Mode`,
+		"Mode":   `ModeXY | "x"`,
+		"ModeXY": `"x" "y"`,
+	})
+	p.SetInputString(`run x -v`)
+	Assert(t, p.Parse(), "Expected the flag of a failed alternative to be given again")
+	Assert(t, len(p.Errors()) == 0, "Expected no duplicate flag")
+}
+
+func TestFlagsBetweenRepetitions(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"copy" --verbose? !string+`})
+	Assert(t, p.ParseArgs([]string{"copy", "a", "--verbose", "b"}), "Expected a flag between two values")
+	Assert(t, p.ParseResult["start_verbose"].Value == true, "Expected --verbose")
+	p.SetInputString(`copy "a" --verbose "b"`)
+	Assert(t, p.Parse(), "Expected a flag between two values of the input line")
+
+	p.SetCommandGrammar(map[string]string{"START": `"tag" -f? !ident % ','`})
+	p.SetInputString(`tag a, -f b`)
+	Assert(t, p.Parse(), "Expected a flag between two elements of a list")
+	values, _ := p.ParseResult["start_ident"].Value.([]CmdToken)
+	Assert(t, len(values) == 2 && p.ParseResult["start_f"].Value == true, "Expected the list and the flag")
+	p.SetInputString(`tag a -f, b -f`)
+	Assert(t, !p.Parse(), "Expected a duplicate flag in a list to fail")
+}
@@ -0,0 +1,389 @@
+package cmdparser
+
+import (
+	"math/rand"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+)
+
+// maxAttempts limits how often the Generator tries to find an input
+const maxAttempts = 100
+
+// sample values of the data types written by the Generator
+var (
+	sampleIdents      = []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	sampleStrings     = []string{"alice", "hello world", "/tmp/out.txt", "x"}
+	sampleExpressions = []string{"size > 10", `name == "board"`, "a + b * 2", "not done"}
+)
+
+// NewGenerator returns a generator of random inputs for the grammar of the
+// parser. The same seed gives the same inputs. The generator parses the inputs
+// to check them, so it replaces the result of the last parse.
+func NewGenerator(p *CommandParser, seed int64) *Generator {
+	g := &Generator{MaxDepth: 8, MaxRepeat: 3, parser: p, random: rand.New(rand.NewSource(seed))}
+	g.depths = map[string]int{}
+	for changed := true; changed; {
+		changed = false
+		for name, rule := range p.rules {
+			if depth, ok := g.ruleDepth(rule); ok && (!g.hasDepth(name) || depth < g.depths[name]) {
+				g.depths[name] = depth
+				changed = true
+			}
+		}
+	}
+	return g
+}
+
+// hasDepth reports if a rule can be matched without calling itself
+func (g *Generator) hasDepth(name string) bool {
+	_, ok := g.depths[name]
+	return ok
+}
+
+// ruleDepth returns the least number of rule calls a rule needs, as far as
+// it is known
+func (g *Generator) ruleDepth(rule *RuleStruct) (int, bool) {
+	result, found := 0, false
+	for _, item := range rule.Items {
+		depth, ok := g.itemDepth(item)
+		switch {
+		case rule.Type == Choice:
+			if ok && (!found || depth < result) {
+				result, found = depth, true
+			}
+		case !ok:
+			return 0, false
+		case depth > result:
+			result = depth
+		}
+	}
+	if rule.Type != Choice || len(rule.Items) == 0 {
+		found = true
+	}
+	return result + 1, found
+}
+
+// itemDepth returns the least number of rule calls an item needs, an item
+// that may be left out needs none
+func (g *Generator) itemDepth(item *RuleItem) (int, bool) {
+	if item.ExprType != SymbolExpr || item.MinOccur == 0 {
+		return 0, true
+	}
+	depth, ok := g.depths[item.ExprString]
+	return depth, ok
+}
+
+// Generate returns a random input the grammar accepts
+func (g *Generator) Generate() (string, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		words, ok := g.generate()
+		if ok && g.accepts(words) {
+			return strings.Join(words, " "), nil
+		}
+	}
+	return "", ErrNoInputGenerated
+}
+
+// Mutate returns a random input the grammar does not accept. It is a valid
+// input with a word left out, repeated, swapped with the next one or replaced
+// by a keyword of the grammar or by a value of another type.
+func (g *Generator) Mutate() (string, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		words, ok := g.generate()
+		if !ok || !g.accepts(words) {
+			continue
+		}
+		words = g.mutate(words)
+		if len(words) > 0 && !g.accepts(words) && !g.parser.TokenizerError {
+			return strings.Join(words, " "), nil
+		}
+	}
+	return "", ErrNoInputGenerated
+}
+
+// generate returns the words of a random input for START
+func (g *Generator) generate() ([]string, bool) {
+	rule, ok := g.parser.rules["START"]
+	if !ok || !g.hasDepth("START") {
+		return nil, false
+	}
+	return g.rule(rule, 0), true
+}
+
+// accepts parses the words and reports if they match
+func (g *Generator) accepts(words []string) bool {
+	if err := g.parser.SetInputString(strings.Join(words, " ")); err != nil {
+		return false
+	}
+	return g.parser.Parse()
+}
+
+// rule returns the words of a random match of a rule, depth is the number of
+// rule calls above it
+func (g *Generator) rule(rule *RuleStruct, depth int) []string {
+	items := rule.Items
+	switch rule.Type {
+	case Choice:
+		items = []*RuleItem{g.alternative(rule, depth)}
+	case Permutation:
+		items = []*RuleItem{}
+		for _, item := range rule.Items {
+			if item.MinOccur > 0 || (depth < g.MaxDepth && g.random.Intn(2) == 0) {
+				items = append(items, item)
+			}
+		}
+		g.random.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	}
+	words := []string{}
+	for _, item := range items {
+		words = append(words, g.item(item, depth)...)
+	}
+	return words
+}
+
+// alternative chooses an alternative of a choice. At MaxDepth it is one of
+// the alternatives with the least rule calls.
+func (g *Generator) alternative(rule *RuleStruct, depth int) *RuleItem {
+	candidates := []*RuleItem{}
+	least := -1
+	for _, item := range rule.Items {
+		d, ok := g.itemDepth(item)
+		switch {
+		case !ok:
+		case depth < g.MaxDepth:
+			candidates = append(candidates, item)
+		case least < 0 || d < least:
+			candidates, least = []*RuleItem{item}, d
+		case d == least:
+			candidates = append(candidates, item)
+		}
+	}
+	if len(candidates) == 0 {
+		return rule.Items[g.random.Intn(len(rule.Items))]
+	}
+	return candidates[g.random.Intn(len(candidates))]
+}
+
+// count chooses how often an item occurs
+func (g *Generator) count(item *RuleItem, depth int) int {
+	min, max := item.MinOccur, item.MaxOccur
+	if max == Unbounded || max-min > g.MaxRepeat {
+		max = min + g.MaxRepeat
+	}
+	if depth >= g.MaxDepth || max <= min {
+		return min
+	}
+	return min + g.random.Intn(max-min+1)
+}
+
+// item returns the words of the occurrences of an item
+func (g *Generator) item(item *RuleItem, depth int) []string {
+	words := []string{}
+	for i, n := 0, g.count(item, depth); i < n; i++ {
+		if i > 0 && item.Separator != nil {
+			words = append(words, item.Separator.ExprString)
+		}
+		words = append(words, g.occurrence(item, depth)...)
+	}
+	if len(words) > 0 && item.Separator != nil && item.TrailingSeparator && g.random.Intn(2) == 0 {
+		words = append(words, item.Separator.ExprString)
+	}
+	return words
+}
+
+// occurrence returns the words of a single occurrence of an item
+func (g *Generator) occurrence(item *RuleItem, depth int) []string {
+	switch item.ExprType {
+	case SymbolExpr:
+		if rule, ok := g.parser.rules[item.ExprString]; ok {
+			return g.rule(rule, depth+1)
+		}
+	case PredicateExpr, NotPredicateExpr:
+		// predicates don't consume input, the parser checks them
+		return nil
+	case FlagExpr:
+		if item.FlagValue != "" {
+			return []string{item.ExprString, g.value(item.FlagValue)}
+		}
+	case DataTypeExpr:
+		return []string{g.value(item.ExprString)}
+	case ClassExpr:
+		return []string{strconv.Quote(g.classSample(item.ExprString))}
+	}
+	return []string{item.ExprString}
+}
+
+// value returns a sample value of a data type as it is written in the input
+func (g *Generator) value(name string) string {
+	switch dataType(name) {
+	case TokenInt:
+		return strconv.Itoa(g.random.Intn(1000))
+	case TokenFloat:
+		return strconv.FormatFloat(float64(g.random.Intn(4000))/4+0.5, 'f', 2, 64)
+	case TokenBool:
+		return g.pick(g.boolWords())
+	case TokenString:
+		return strconv.Quote(g.pick(sampleStrings))
+	case TokenExpr:
+		d := ExprDelimiter{Open: '\'', Close: '\''}
+		if tokenizer, ok := g.parser.tokenizer.(*DefaultTokenizer); ok && len(tokenizer.delimiters()) > 0 {
+			d = tokenizer.delimiters()[0]
+		}
+		return string(d.Open) + g.pick(sampleExpressions) + string(d.Close)
+	case TokenChar:
+		return "@"
+	case TokenIdent:
+		return g.pick(g.idents())
+	}
+	return name
+}
+
+// pick returns a random word of a list
+func (g *Generator) pick(words []string) string {
+	return words[g.random.Intn(len(words))]
+}
+
+// boolWords returns the words the tokenizer reads as booleans, sorted so the
+// same seed picks the same word
+func (g *Generator) boolWords() []string {
+	if tokenizer, ok := g.parser.tokenizer.(*DefaultTokenizer); ok {
+		return sortedKeys(tokenizer.boolWords())
+	}
+	return sortedKeys(DefaultBoolWords)
+}
+
+// idents returns the sample identifiers that are not keywords or reserved
+func (g *Generator) idents() []string {
+	keywords := map[string]bool{}
+	for _, word := range g.boolWords() {
+		keywords[word] = true
+	}
+	for _, rule := range g.parser.rules {
+		for _, item := range rule.Items {
+			if item.ExprType == IdentifierExpr {
+				keywords[strings.ToLower(item.ExprString)] = true
+			}
+		}
+	}
+	result := []string{}
+	for _, word := range sampleIdents {
+		if !keywords[word] && !g.parser.isReserved(word) {
+			result = append(result, word)
+		}
+	}
+	if len(result) == 0 {
+		return []string{"zeta"}
+	}
+	return result
+}
+
+// classSample returns a random string that matches a regular expression,
+// the expression of an invalid class is returned as it is
+func (g *Generator) classSample(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return expr
+	}
+	var b strings.Builder
+	g.regexpSample(re, &b)
+	return b.String()
+}
+
+// regexpSample writes a random match of a parsed regular expression, anchors
+// and word boundaries are left out
+func (g *Generator) regexpSample(re *syntax.Regexp, b *strings.Builder) {
+	repeat := func(min, max int) {
+		if max < 0 {
+			max = min + 2
+		}
+		for i, n := 0, min+g.random.Intn(max-min+1); i < n; i++ {
+			g.regexpSample(re.Sub[0], b)
+		}
+	}
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(g.classRune(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteRune(rune('a' + g.random.Intn(26)))
+	case syntax.OpCapture:
+		g.regexpSample(re.Sub[0], b)
+	case syntax.OpStar:
+		repeat(0, 2)
+	case syntax.OpPlus:
+		repeat(1, 3)
+	case syntax.OpQuest:
+		repeat(0, 1)
+	case syntax.OpRepeat:
+		repeat(re.Min, re.Max)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.regexpSample(sub, b)
+		}
+	case syntax.OpAlternate:
+		g.regexpSample(re.Sub[g.random.Intn(len(re.Sub))], b)
+	}
+}
+
+// classRune returns a rune of the ranges of a char class, printable ASCII
+// is preferred. Quotes, backslashes and $ are avoided, they have a meaning in
+// strings of the input.
+func (g *Generator) classRune(ranges []rune) rune {
+	candidates := []rune{}
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1] && r <= '~'; r++ {
+			if r > ' ' && !strings.ContainsRune(`"\$`, r) {
+				candidates = append(candidates, r)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		if len(ranges) == 0 {
+			return 'x'
+		}
+		return ranges[0]
+	}
+	return candidates[g.random.Intn(len(candidates))]
+}
+
+// mutate changes a word of a valid input, so it is likely to be invalid
+func (g *Generator) mutate(words []string) []string {
+	i := g.random.Intn(len(words))
+	result := append([]string{}, words...)
+	switch g.random.Intn(5) {
+	case 0:
+		return append(result[:i], result[i+1:]...)
+	case 1:
+		return append(result[:i+1], result[i:]...)
+	case 2:
+		if i+1 < len(result) {
+			result[i], result[i+1] = result[i+1], result[i]
+			return result
+		}
+		return result[:i]
+	case 3:
+		result[i] = g.pick(g.keywords())
+	default:
+		result[i] = g.value(g.pick([]string{"int", "string", "ident", "float", "expression"}))
+	}
+	return result
+}
+
+// keywords returns the keywords and chars of the grammar, sorted so the same
+// seed picks the same word
+func (g *Generator) keywords() []string {
+	words := map[string]bool{}
+	for _, rule := range g.parser.rules {
+		for _, item := range rule.Items {
+			if item.ExprType == IdentifierExpr || item.ExprType == CharExpr {
+				words[item.ExprString] = true
+			}
+		}
+	}
+	if len(words) == 0 {
+		return []string{"@"}
+	}
+	return sortedKeys(words)
+}
@@ -0,0 +1,66 @@
+package cmdparser
+
+import "testing"
+
+func TestGenerate(t *testing.T) {
+	grammars := []map[string]string{arithmeticGrammar, commandGrammar, flagGrammar, scriptGrammar, {
+		"START": `"set" !ident & --mode=!bool? & ("size" !float{2})? & "tags" ([a-z]+[0-9]) %% ','`,
+	}}
+	for _, grammar := range grammars {
+		p := NewParser()
+		p.SetCommandGrammar(grammar)
+		g := NewGenerator(p, 7)
+		for i := 0; i < 50; i++ {
+			input, err := g.Generate()
+			Assert(t, err == nil, "Expected an input")
+			p.SetInputString(input)
+			Assert(t, p.Parse(), "Expected the generated input to match: "+input)
+
+			input, err = g.Mutate()
+			Assert(t, err == nil, "Expected a mutated input")
+			p.SetInputString(input)
+			Assert(t, !p.Parse(), "Expected the mutated input not to match: "+input)
+		}
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	first, second := NewGenerator(p, 42), NewGenerator(p, 42)
+	for i := 0; i < 10; i++ {
+		a, _ := first.Generate()
+		b, _ := second.Generate()
+		Assert(t, a == b, "Expected the same inputs for the same seed")
+	}
+
+	p.SetCommandGrammar(arithmeticGrammar)
+	g := NewGenerator(p, 1)
+	g.MaxDepth = 0
+	input, _ := g.Generate()
+	Assert(t, len(input) < len("calc 1000"), "Expected the shortest input at depth 0: "+input)
+
+	p.SetCommandGrammar(map[string]string{"START": `"a" START`})
+	_, err := NewGenerator(p, 1).Generate()
+	Assert(t, err == ErrNoInputGenerated, "Expected no input for a rule without an end")
+}
+
+// FuzzParse checks that the parser does not panic and builds a parse tree for
+// every match. The corpus starts with generated and mutated inputs.
+func FuzzParse(f *testing.F) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	g := NewGenerator(p, 1)
+	for i := 0; i < 20; i++ {
+		valid, _ := g.Generate()
+		invalid, _ := g.Mutate()
+		f.Add(valid)
+		f.Add(invalid)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		if p.SetInputString(input) != nil {
+			return
+		}
+		if p.Parse() && p.ParseTree() == nil {
+			t.Errorf("Expected a parse tree for %q", input)
+		}
+	})
+}
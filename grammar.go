@@ -0,0 +1,62 @@
+package cmdparser
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// grammarLine matches the start of a rule in a grammar file
+var grammarLine = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*:(.*)$`)
+
+// ReadGrammar reads a grammar from a text file with one `Name: expression`
+// rule per line. A line that starts with a blank continues the rule of the
+// previous line, blank lines and lines starting with COMMENTCHAR are skipped.
+// A rule defined twice is reported as ErrDuplicateRule.
+// If the reader has a Name method, like os.File, the name is used in the errors.
+func ReadGrammar(r io.Reader) (map[string]string, error) {
+	name := "<input>"
+	if named, ok := r.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	current := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed[0] == COMMENTCHAR:
+		case line[0] == ' ' || line[0] == '\t':
+			if current == "" {
+				return nil, &ScriptError{File: name, Line: i + 1, Column: 1, Err: ErrInvalidGrammarLine}
+			}
+			result[current] += " " + trimmed
+		default:
+			m := grammarLine.FindStringSubmatch(line)
+			if m == nil {
+				return nil, &ScriptError{File: name, Line: i + 1, Column: 1, Err: ErrInvalidGrammarLine}
+			}
+			current = m[1]
+			if _, found := result[current]; found {
+				return nil, &ScriptError{File: name, Line: i + 1, Column: 1, Err: ErrDuplicateRule}
+			}
+			result[current] = strings.TrimSpace(m[2])
+		}
+	}
+	return result, nil
+}
+
+// ReadGrammarFile reads a grammar file, see ReadGrammar
+func ReadGrammarFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGrammar(f)
+}
@@ -0,0 +1,191 @@
+package cmdparser
+
+import "sort"
+
+// LeftRecursion returns the cycles of rules that call themselves without
+// consuming input, like Expr in `Expr "+" Term | Term`. Each cycle starts and
+// ends with the same rule, the shortest cycle of a rule is reported once. The
+// parser grows the match of these rules step by step, so they work, but every
+// cycle needs a non recursive alternative.
+func (theParser *CommandParser) LeftRecursion() [][]string {
+	nullable := theParser.nullableRules()
+	result := [][]string{}
+	for _, name := range theParser.ruleNames() {
+		path := theParser.leftPath(name, nullable)
+		if path == nil {
+			continue
+		}
+		// report each cycle once, starting with its smallest rule name
+		smallest := true
+		for _, other := range path {
+			smallest = smallest && name <= other
+		}
+		if smallest {
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+// ruleNames returns the sorted names of the rules
+func (theParser *CommandParser) ruleNames() []string {
+	names := []string{}
+	for name := range theParser.rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// markLeftRecursion flags the rules that are part of a left recursive cycle
+func (theParser *CommandParser) markLeftRecursion() {
+	nullable := theParser.nullableRules()
+	for name, rule := range theParser.rules {
+		rule.leftRecursive = theParser.leftPath(name, nullable) != nil
+	}
+}
+
+// leftPath returns the shortest path of left calls from a rule back to itself, nil if there is none
+func (theParser *CommandParser) leftPath(name string, nullable map[string]bool) []string {
+	parent := map[string]string{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range theParser.leftCalls(theParser.rules[current], nullable) {
+			if next == name {
+				path := []string{name}
+				for n := current; n != name; n = parent[n] {
+					path = append([]string{n}, path...)
+				}
+				return append([]string{name}, path...)
+			}
+			if _, seen := parent[next]; !seen {
+				parent[next] = current
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// leftCalls returns the rules a rule may call before it consumes any input
+func (theParser *CommandParser) leftCalls(rule *RuleStruct, nullable map[string]bool) []string {
+	result := []string{}
+	if rule == nil {
+		return result
+	}
+	for _, item := range rule.Items {
+		if _, ok := theParser.rules[item.ExprString]; ok && (item.ExprType == SymbolExpr || item.ExprType == PredicateExpr || item.ExprType == NotPredicateExpr) {
+			result = append(result, item.ExprString)
+		}
+		if rule.Type == Sequence && !theParser.nullableItem(item, nullable) {
+			break
+		}
+	}
+	return result
+}
+
+// nullableRules returns the rules that can match without consuming input
+func (theParser *CommandParser) nullableRules() map[string]bool {
+	return theParser.rulesWhere(theParser.nullableItem)
+}
+
+// rulesWhere returns the rules whose items satisfy the item test: any item of a
+// choice, all items of a sequence or a permutation. The test gets the rules
+// found so far, so rules that refer to each other are found, too.
+func (theParser *CommandParser) rulesWhere(test func(*RuleItem, map[string]bool) bool) map[string]bool {
+	found := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for name, rule := range theParser.rules {
+			if !found[name] && ruleWhere(rule, found, test) {
+				found[name] = true
+				changed = true
+			}
+		}
+	}
+	return found
+}
+
+// ruleWhere applies the item test of rulesWhere to the items of a rule
+func ruleWhere(rule *RuleStruct, found map[string]bool, test func(*RuleItem, map[string]bool) bool) bool {
+	if rule.Type == Choice {
+		for _, item := range rule.Items {
+			if test(item, found) {
+				return true
+			}
+		}
+		return false
+	}
+	// all items of a sequence or a permutation
+	for _, item := range rule.Items {
+		if !test(item, found) {
+			return false
+		}
+	}
+	return true
+}
+
+// nullableItem reports if an item can match without input
+func (theParser *CommandParser) nullableItem(item *RuleItem, nullable map[string]bool) bool {
+	switch {
+	case item.MinOccur == 0:
+		return true
+	case item.ExprType == PredicateExpr || item.ExprType == NotPredicateExpr || item.ExprType == FlagExpr:
+		return true
+	case item.ExprType == SymbolExpr:
+		return nullable[item.ExprString]
+	}
+	return false
+}
+
+// matchLeftRecursive matches a left recursive rule by growing a seed. The first
+// round matches the rule with the recursive call failing, every following round
+// lets the recursive call return the match of the previous round. The rounds stop
+// when the match doesn't get longer.
+func (theParser *CommandParser) matchLeftRecursive(rule *RuleStruct) bool {
+	key := memoKey{rule: rule, pos: theParser.tokenPos}
+	if state, ok := theParser.growing[key]; ok {
+		// the recursive call returns the seed
+		state.detected = true
+		theParser.replay(state.seed)
+		return state.seed.match
+	}
+	if theParser.growing == nil {
+		theParser.growing = map[memoKey]*growState{}
+	}
+	start := key.pos
+	state := &growState{seed: &memoEntry{match: false, end: start}}
+	theParser.growing[key] = state
+	defer delete(theParser.growing, key)
+
+	capturesStart := len(theParser.captures)
+	match := theParser.applyRule(rule)
+	for match && state.detected && theParser.tokenPos > state.seed.end {
+		state.seed = &memoEntry{
+			match:    true,
+			end:      theParser.tokenPos,
+			captures: append([]capture{}, theParser.captures[capturesStart:]...),
+		}
+		// the next round replays the seed
+		theParser.backtrack(rule, start, capturesStart)
+		if !theParser.applyRule(rule) || theParser.tokenPos <= state.seed.end {
+			// the last round did not get further, use the seed
+			theParser.captures = theParser.captures[:capturesStart]
+			theParser.replay(state.seed)
+			return true
+		}
+	}
+	return match
+}
+
+// replay restores the end position and the captures of a memoized match
+func (theParser *CommandParser) replay(entry *memoEntry) {
+	for _, c := range entry.captures {
+		c.item.TokenPtr = c.tok
+		theParser.captures = append(theParser.captures, c)
+	}
+	theParser.errorList = append(theParser.errorList, entry.errors...)
+	theParser.tokenPos = entry.end
+}
@@ -0,0 +1,66 @@
+package cmdparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+var arithmeticGrammar = map[string]string{
+	"START":  `"calc" Expr`,
+	"Expr":   `Expr '+' Term | Expr '-' Term | Term`,
+	"Term":   `Term '*' Factor | Factor`,
+	"Factor": `!int | '(' Expr ')'`,
+}
+
+func TestLeftRecursion(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(arithmeticGrammar)
+	cycles := p.LeftRecursion()
+	expected := [][]string{{"Expr", "Expr.1", "Expr"}, {"Term", "Term.1", "Term"}}
+	Assert(t, reflect.DeepEqual(cycles, expected), "Expected the left recursive cycles")
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": `A`,
+		"A":     `B "x" | "a"`,
+		"B":     `"b"? A "y"`,
+	})
+	Assert(t, reflect.DeepEqual(p.LeftRecursion(), [][]string{{"A", "A.1", "B", "A"}}), "Expected the indirect cycle")
+
+	p = NewParser()
+	p.SetCommandGrammar(scriptGrammar)
+	Assert(t, len(p.LeftRecursion()) == 0, "Expected no left recursion")
+}
+
+func TestLeftRecursiveParse(t *testing.T) {
+	data := []struct {
+		Input string
+		Match bool
+	}{
+		{`calc 1`, true},
+		{`calc 1 + 2`, true},
+		{`calc 1 + 2 * 3 - 4`, true},
+		{`calc (1 + 2) * 3`, true},
+		{`calc 1 +`, false},
+		{`calc + 1`, false},
+		{`calc (1 + 2`, false},
+	}
+	for _, memo := range []uint64{0, OptionMemoize} {
+		p := NewParser()
+		p.SetOptions(memo)
+		p.SetCommandGrammar(arithmeticGrammar)
+		for _, entry := range data {
+			p.SetInputString(entry.Input)
+			if p.Parse() != entry.Match {
+				t.Error("Left recursion failed for " + entry.Input)
+			}
+		}
+	}
+
+	// the last round of the left recursive rule wins
+	p := NewParser()
+	p.SetCommandGrammar(arithmeticGrammar)
+	p.SetInputString(`calc 1 + 2 + 3`)
+	Assert(t, p.Parse(), "Expected a match")
+	Assert(t, p.ParseResult["expr.1_term"].Text == "3", "Expected the last term")
+}
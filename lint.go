@@ -0,0 +1,365 @@
+package cmdparser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lint checks the grammar for mistakes the parser can't report. It finds
+// items that can't be compiled, references to missing rules, rules that can't be reached from START or a
+// filter, alternatives of a choice that are never tried because an earlier
+// alternative matches first, repeated items that match without input and
+// keywords that the tokenizer reads as something else or that !ident matches,
+// too. The issues are sorted by rule.
+func (theParser *CommandParser) Lint() []LintIssue {
+	issues := []LintIssue{}
+	if _, ok := theParser.rules["START"]; !ok && len(theParser.rules) > 0 {
+		issues = append(issues, LintIssue{Rule: "START", Kind: LintMissingRule, Message: "missing rule START"})
+	}
+	nullable := theParser.nullableRules()
+	always := theParser.rulesWhere(alwaysItem)
+	first := theParser.FirstSets()
+	reachable := theParser.reachableRules()
+	for _, name := range theParser.ruleNames() {
+		rule := theParser.rules[name]
+		if _, ok := theParser.grammar[name]; ok && !reachable[name] {
+			issues = append(issues, LintIssue{Rule: name, Kind: LintUnreachable, Message: "not reachable from START"})
+		}
+		if rule.invalid != nil {
+			issues = append(issues, LintIssue{Rule: name, Kind: LintInvalidItem, Message: "can't be compiled, it never matches: " + rule.invalid.Err.Error()})
+		}
+		for _, item := range rule.Items {
+			issues = append(issues, theParser.lintItem(item, nullable)...)
+			if item.Separator != nil {
+				issues = append(issues, theParser.lintItem(item.Separator, nullable)...)
+			}
+		}
+		if rule.Type == Choice {
+			issues = append(issues, theParser.lintChoice(rule, always, first)...)
+		}
+	}
+	return issues
+}
+
+// FirstSets returns the tokens each rule can start with, as they are written
+// in the grammar: "keywords", 'c' characters, !types and [classes]. Flags are
+// left out, they may be given anywhere.
+func (theParser *CommandParser) FirstSets() map[string][]string {
+	nullable := theParser.nullableRules()
+	first := map[string]map[string]bool{}
+	for name := range theParser.rules {
+		first[name] = map[string]bool{}
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, rule := range theParser.rules {
+			for _, item := range rule.Items {
+				for _, t := range theParser.itemFirst(item, first) {
+					if !first[name][t] {
+						first[name][t] = true
+						changed = true
+					}
+				}
+				if rule.Type == Sequence && !theParser.nullableItem(item, nullable) {
+					break
+				}
+			}
+		}
+	}
+	result := map[string][]string{}
+	for name, set := range first {
+		result[name] = sortedKeys(set)
+	}
+	return result
+}
+
+// itemFirst returns the tokens an item can start with, given the FIRST sets found so far
+func (theParser *CommandParser) itemFirst(item *RuleItem, first map[string]map[string]bool) []string {
+	switch item.ExprType {
+	case IdentifierExpr, CharExpr, DataTypeExpr, ClassExpr:
+		return []string{terminal(item)}
+	case SymbolExpr:
+		return sortedKeys(first[item.ExprString])
+	}
+	return nil
+}
+
+// terminal returns an item that matches a single token as it is written in the grammar
+func terminal(item *RuleItem) string {
+	switch item.ExprType {
+	case IdentifierExpr:
+		return `"` + item.ExprString + `"`
+	case CharExpr:
+		return "'" + item.ExprString + "'"
+	case DataTypeExpr:
+		return "!" + strings.ToLower(item.ExprString)
+	}
+	return item.ExprString
+}
+
+// sortedKeys returns the sorted keys of a set
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// reachableRules returns the rules that START and the filters call, directly or indirectly
+func (theParser *CommandParser) reachableRules() map[string]bool {
+	reachable := map[string]bool{}
+	queue := []string{"START"}
+	for name := range theParser.filters {
+		queue = append(queue, filterRule(name))
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		rule, ok := theParser.rules[name]
+		if !ok || reachable[name] {
+			continue
+		}
+		reachable[name] = true
+		for _, item := range rule.Items {
+			queue = append(queue, item.ExprString)
+			if item.Separator != nil {
+				queue = append(queue, item.Separator.ExprString)
+			}
+		}
+	}
+	return reachable
+}
+
+// isRuleCall reports if an item calls another rule
+func isRuleCall(item *RuleItem) bool {
+	return item.ExprType == SymbolExpr || item.ExprType == PredicateExpr || item.ExprType == NotPredicateExpr
+}
+
+// lintItem checks an item for a missing rule, a repetition without input and a keyword that never matches
+func (theParser *CommandParser) lintItem(item *RuleItem, nullable map[string]bool) []LintIssue {
+	issues := []LintIssue{}
+	name := item.ParentRule.Name
+	if item.invalid != nil {
+		issues = append(issues, LintIssue{Rule: name, Kind: LintInvalidItem, Message: item.invalid.Item + " can't be compiled, it never matches: " + item.invalid.Err.Error()})
+	}
+	if _, ok := theParser.rules[item.ExprString]; isRuleCall(item) && !ok {
+		issues = append(issues, LintIssue{Rule: name, Kind: LintMissingRule, Message: "missing rule " + item.ExprString})
+	}
+	if item.MaxOccur > 1 && item.Separator == nil && (item.ExprType == PredicateExpr || item.ExprType == NotPredicateExpr || (item.ExprType == SymbolExpr && nullable[item.ExprString])) {
+		issues = append(issues, LintIssue{Rule: name, Kind: LintNullableLoop, Message: theParser.itemSource(item) + " repeats an item that matches without input"})
+	}
+	if item.ExprType == IdentifierExpr {
+		if !isIdentifier(item.ExprString) {
+			issues = append(issues, LintIssue{Rule: name, Kind: LintKeyword, Message: terminal(item) + " is not an identifier, it never matches"})
+		} else if tokenizer, ok := theParser.tokenizer.(*DefaultTokenizer); ok {
+			if tok, _ := tokenizer.tokenFromIdentifier(&PreToken{Text: item.ExprString}); tok.Type == TokenBool {
+				issues = append(issues, LintIssue{Rule: name, Kind: LintKeyword, Message: terminal(item) + " is read as a bool, it never matches"})
+			}
+		}
+	}
+	return issues
+}
+
+// lintChoice checks for alternatives of a choice that are never tried and for
+// keywords of an alternative that another alternative matches as !ident
+func (theParser *CommandParser) lintChoice(rule *RuleStruct, always map[string]bool, first map[string][]string) []LintIssue {
+	issues := []LintIssue{}
+	shadowed := map[int]bool{}
+	for j, later := range rule.Items {
+		for i, earlier := range rule.Items[:j] {
+			if theParser.shadows(earlier, later, always) {
+				issues = append(issues, LintIssue{Rule: rule.Name, Kind: LintShadowed, Message: "alternative " + strconv.Itoa(j+1) + " " + theParser.itemSource(later) +
+					" is never tried, alternative " + strconv.Itoa(i+1) + " " + theParser.itemSource(earlier) + " matches first"})
+				shadowed[j] = true
+				break
+			}
+		}
+	}
+	for j, item := range rule.Items {
+		if shadowed[j] {
+			continue
+		}
+		for _, kw := range theParser.firstOf(item, first) {
+			if !strings.HasPrefix(kw, `"`) || theParser.isReserved(strings.Trim(kw, `"`)) {
+				continue
+			}
+			for i, other := range rule.Items {
+				if i != j && !shadowed[i] && contains(theParser.firstOf(other, first), "!ident") {
+					issues = append(issues, LintIssue{Rule: rule.Name, Kind: LintKeyword, Message: "keyword " + kw + " of alternative " + strconv.Itoa(j+1) +
+						" is an identifier of alternative " + strconv.Itoa(i+1) + ", reserve it with SetReservedWords"})
+					break
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// firstOf returns the FIRST set of an item of a choice
+func (theParser *CommandParser) firstOf(item *RuleItem, first map[string][]string) []string {
+	if item.ExprType == SymbolExpr {
+		return first[item.ExprString]
+	}
+	if item.ExprType == PredicateExpr || item.ExprType == NotPredicateExpr || item.ExprType == FlagExpr {
+		return nil
+	}
+	return []string{terminal(item)}
+}
+
+// contains reports if a list of strings contains a string
+func contains(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
+
+// alwaysItem reports if an item matches any input, given the rules found so far that always match
+func alwaysItem(item *RuleItem, always map[string]bool) bool {
+	return item.MinOccur == 0 || (item.ExprType == SymbolExpr && always[item.ExprString])
+}
+
+// shadows reports if the earlier alternative of a choice matches everything the
+// later one starts with. The choice takes the first alternative that matches,
+// so the later alternative is never tried.
+func (theParser *CommandParser) shadows(earlier, later *RuleItem, always map[string]bool) bool {
+	if alwaysItem(earlier, always) {
+		return true
+	}
+	prefix, ok := theParser.terminals(earlier, 0)
+	if !ok {
+		return false
+	}
+	tokens, ok := theParser.terminals(later, 0)
+	if !ok || len(tokens) < len(prefix) {
+		return false
+	}
+	for k := range prefix {
+		if !theParser.covers(prefix[k], tokens[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// terminals returns the tokens of an item that always matches the same sequence
+// of single tokens, like "show" "table" !ident. ok is false for any other item.
+func (theParser *CommandParser) terminals(item *RuleItem, depth int) ([]string, bool) {
+	if item.MinOccur != 1 || item.MaxOccur != 1 || item.Separator != nil || depth > len(theParser.rules) {
+		return nil, false
+	}
+	switch item.ExprType {
+	case IdentifierExpr, CharExpr, DataTypeExpr, ClassExpr:
+		return []string{terminal(item)}, true
+	case SymbolExpr:
+		rule, ok := theParser.rules[item.ExprString]
+		if !ok || (rule.Type != Sequence && len(rule.Items) != 1) {
+			return nil, false
+		}
+		result := []string{}
+		for _, sub := range rule.Items {
+			tokens, ok := theParser.terminals(sub, depth+1)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, tokens...)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// covers reports if the token x of the grammar matches every token y matches
+func (theParser *CommandParser) covers(x, y string) bool {
+	switch {
+	case x == y:
+		return true
+	case x == "!ident" && strings.HasPrefix(y, `"`):
+		return !theParser.isReserved(strings.Trim(y, `"`))
+	case x == "!string" && strings.HasPrefix(y, "["):
+		return true
+	}
+	return false
+}
+
+// itemSource returns an item as it is written in the grammar, groups are
+// written out in parentheses
+func (theParser *CommandParser) itemSource(item *RuleItem) string {
+	s := terminal(item)
+	switch item.ExprType {
+	case FlagExpr:
+		if item.FlagValue != "" {
+			s += "=!" + item.FlagValue
+		}
+	case SymbolExpr, PredicateExpr, NotPredicateExpr:
+		if rule, ok := theParser.rules[item.ExprString]; ok && strings.HasPrefix(item.ExprString, item.ParentRule.Name+".") {
+			s = "(" + theParser.ruleSource(rule) + ")"
+		}
+		if item.ExprType == PredicateExpr {
+			s = "&" + s
+		} else if item.ExprType == NotPredicateExpr {
+			s = "~" + s
+		}
+	}
+	if item.Separator != nil {
+		operator := LISTSTRING
+		if item.TrailingSeparator {
+			operator += LISTSTRING
+		}
+		s += " " + operator + " " + terminal(item.Separator)
+		switch {
+		case item.MinOccur == 1 && item.MaxOccur == Unbounded:
+			return s
+		case item.MinOccur == 0 && item.MaxOccur == Unbounded:
+			return s + "?"
+		}
+	}
+	return s + occurrence(item.MinOccur, item.MaxOccur)
+}
+
+// occurrence returns the suffix of an item that occurs min to max times
+func occurrence(min, max int) string {
+	switch {
+	case min == 1 && max == 1:
+		return ""
+	case min == 0 && max == 1:
+		return "?"
+	case min == 0 && max == Unbounded:
+		return "*"
+	case min == 1 && max == Unbounded:
+		return "+"
+	case min == max:
+		return "{" + strconv.Itoa(min) + "}"
+	case max == Unbounded:
+		return "{" + strconv.Itoa(min) + ",}"
+	}
+	return "{" + strconv.Itoa(min) + "," + strconv.Itoa(max) + "}"
+}
+
+// ruleSource returns the expression of a rule as it is written in the grammar.
+// The alternatives of a choice or a permutation that are groups of several
+// items are written without parentheses.
+func (theParser *CommandParser) ruleSource(rule *RuleStruct) string {
+	operator := " "
+	switch rule.Type {
+	case Choice:
+		operator = " " + CHOICESTRING + " "
+	case Permutation:
+		operator = " " + PERMUTATIONSTRING + " "
+	}
+	parts := []string{}
+	for _, item := range rule.Items {
+		s := theParser.itemSource(item)
+		if group, ok := theParser.rules[item.ExprString]; rule.Type != Sequence && ok && item.ExprType == SymbolExpr &&
+			group.Type == Sequence && strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+			s = s[1 : len(s)-1]
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, operator)
+}
@@ -0,0 +1,103 @@
+package cmdparser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFirstSets(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(arithmeticGrammar)
+	first := p.FirstSets()
+	Assert(t, reflect.DeepEqual(first["Expr"], []string{"!int", "'('"}), "Expected the FIRST set of Expr")
+	Assert(t, reflect.DeepEqual(first["START"], []string{`"calc"`}), "Expected the FIRST set of START")
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": `Opt? [a-z]+ | -v`,
+		"Opt":   `"opt" | !Int`,
+	})
+	first = p.FirstSets()
+	Assert(t, reflect.DeepEqual(first["START.1"], []string{"!int", `"opt"`, "[a-z]"}), "Expected the FIRST set after a nullable item")
+	Assert(t, reflect.DeepEqual(first["START"], first["START.1"]), "Expected no flags in the FIRST set")
+}
+
+func TestLint(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	Assert(t, len(p.Lint()) == 0, "Expected no issues for the command grammar")
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START":  `"show" !ident | "show" "all" | "list" Names Target`,
+		"Target": `!ident | "users"`,
+		"Names":  `Maybe+ "yes"`,
+		"Maybe":  `"name"?`,
+		"Unused": `"x" Missing`,
+	})
+	expected := []string{
+		`Rule Names, Maybe+ repeats an item that matches without input [nullable-loop]`,
+		`Rule Names, "yes" is read as a bool, it never matches [keyword]`,
+		`Rule START, alternative 2 ("show" "all") is never tried, alternative 1 ("show" !ident) matches first [shadowed]`,
+		`Rule Target, alternative 2 "users" is never tried, alternative 1 !ident matches first [shadowed]`,
+		`Rule Unused, not reachable from START [unreachable]`,
+		`Rule Unused, missing rule Missing [missing-rule]`,
+	}
+	issues := []string{}
+	for _, issue := range p.Lint() {
+		issues = append(issues, issue.String())
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Error("Unexpected issues:\n" + strings.Join(issues, "\n"))
+	}
+
+	// a keyword that is an identifier of another alternative
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"all" | !ident "to" | ~("x") '*'`})
+	issues = []string{}
+	for _, issue := range p.Lint() {
+		issues = append(issues, issue.String())
+	}
+	Assert(t, reflect.DeepEqual(issues, []string{`Rule START, keyword "all" of alternative 1 is an identifier of alternative 2, reserve it with SetReservedWords [keyword]`}), "Expected a keyword overlap")
+	p.SetReservedWords("all")
+	Assert(t, len(p.Lint()) == 0, "Expected no overlap for a reserved word")
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{"Cmd": `"a"`})
+	Assert(t, len(p.Lint()) == 2 && p.Lint()[0].Kind == LintMissingRule, "Expected a missing START")
+}
+
+func TestRuleSource(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": `"set" ("key" !string)+ --count=!int? !int % ','? &(Value) [a-z]{2,} | "add" "column"`,
+		"Value": `!int`,
+	})
+	Assert(t, p.ruleSource(p.rules["START"]) == `"set" ("key" !string)+ --count=!int? !int % ','? &(Value) [a-z]{2,} | "add" "column"`,
+		"Expected the rule written out: "+p.ruleSource(p.rules["START"]))
+}
+
+func TestReadGrammar(t *testing.T) {
+	grammar, err := ReadGrammar(strings.NewReader(`# a grammar
+START: "show" Target
+	"to" !string
+
+Target: "users" | "groups"
+`))
+	Assert(t, err == nil, "Expected no error")
+	Assert(t, reflect.DeepEqual(grammar, map[string]string{
+		"START":  `"show" Target "to" !string`,
+		"Target": `"users" | "groups"`,
+	}), "Expected the rules of the grammar file")
+
+	_, err = ReadGrammar(strings.NewReader("START: \"a\"\n\"b\" C\n"))
+	var scriptErr *ScriptError
+	Assert(t, errors.As(err, &scriptErr) && scriptErr.Line == 2, "Expected an error in line 2")
+	Assert(t, errors.Is(err, ErrInvalidGrammarLine), "Expected ErrInvalidGrammarLine")
+
+	_, err = ReadGrammar(strings.NewReader("START: Target\nTarget: \"users\"\n\nTarget: \"groups\"\n"))
+	Assert(t, errors.As(err, &scriptErr) && scriptErr.Line == 4, "Expected an error in line 4")
+	Assert(t, errors.Is(err, ErrDuplicateRule), "Expected ErrDuplicateRule")
+}
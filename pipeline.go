@@ -0,0 +1,172 @@
+package cmdparser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// RegisterFilter adds a filter to the filter grammar. Once a filter is registered,
+// Parse treats PIPECHAR as the separator of a pipeline: the command is matched
+// against START, each following stage against the rule of the filter named by the
+// first word of the stage. The rule usually starts with the filter name, as in
+// `"include" !string`, and may use the other rules of the grammar. The rules of
+// the filters don't clash with the rules of the grammar, the results of a stage
+// are named after the filter, like include_string. A filter without a function
+// is an ErrMissingFilterFunc, a filter registered twice an ErrDuplicateRule.
+func (theParser *CommandParser) RegisterFilter(name, rule string, fn FilterFunc) error {
+	if fn == nil {
+		return fmt.Errorf("filter %s: %w", name, ErrMissingFilterFunc)
+	}
+	if _, exists := theParser.filters[name]; exists {
+		return fmt.Errorf("filter %s: %w", name, ErrDuplicateRule)
+	}
+	if theParser.filters == nil {
+		theParser.filters = map[string]*filterDef{}
+	}
+	compiled, err := theParser.prepareRule(filterRule(name), rule)
+	if err != nil {
+		return err
+	}
+	theParser.grammar[filterRule(name)] = rule
+	theParser.rules[filterRule(name)] = compiled
+	theParser.grammarChanged()
+	theParser.filters[name] = &filterDef{name: name, fn: fn}
+	return nil
+}
+
+// filterRule returns the name of the rule of a filter. It starts with PIPECHAR,
+// which a rule of the grammar can't.
+func filterRule(name string) string {
+	return string(PIPECHAR) + name
+}
+
+// RegisterStandardFilters registers the filters include, exclude, count and head.
+// Returns the first error of RegisterFilter, like a rule that is already defined.
+func (theParser *CommandParser) RegisterStandardFilters() error {
+	filters := []struct {
+		name, rule string
+		fn         FilterFunc
+	}{
+		{"include", `"include" !string`, IncludeFilter},
+		{"exclude", `"exclude" !string`, ExcludeFilter},
+		{"count", `"count"`, CountFilter},
+		{"head", `"head" !int`, HeadFilter},
+	}
+	for _, filter := range filters {
+		if err := theParser.RegisterFilter(filter.name, filter.rule, filter.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseStage parses the tokens of a filter stage and appends it to Stages if
+// its arguments match
+func (theParser *CommandParser) parseStage(tokens []*CmdToken) bool {
+	if len(tokens) == 0 {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: 0, Message: "Missing filter after " + string(PIPECHAR)})
+		return false
+	}
+	filter, ok := theParser.filters[tokens[0].Text]
+	if !ok || tokens[0].Type != TokenIdent {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: tokens[0].Position.Column, Message: "Unknown filter " + tokens[0].Text})
+		return false
+	}
+	match := theParser.parseTokens(theParser.rules[filterRule(filter.name)], tokens)
+	if !match {
+		theParser.errorList = append(theParser.errorList, &ParseError{Column: tokens[0].Position.Column, Message: "Invalid arguments for filter " + filter.name})
+		return false
+	}
+	theParser.Stages = append(theParser.Stages, &PipelineStage{
+		Name:        filter.name,
+		Position:    tokens[0].Position,
+		ParseResult: theParser.ParseResult,
+		fn:          filter.fn,
+	})
+	return true
+}
+
+// RunPipeline streams the output lines of the command through the filter stages
+// of the last Parse. The lines of source are passed to the first filter, sink is
+// called for every line of the last filter. Returns the first filter error, or
+// ErrNoMatch without reading source if the last Parse did not match.
+func (theParser *CommandParser) RunPipeline(source <-chan string, sink func(line string)) error {
+	if !theParser.IsMatch {
+		return ErrNoMatch
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(theParser.Stages))
+	in := source
+	for i, stage := range theParser.Stages {
+		out := make(chan string)
+		wg.Add(1)
+		go func(i int, stage *PipelineStage, in <-chan string, out chan<- string) {
+			defer wg.Done()
+			errs[i] = stage.fn(stage.ParseResult, in, out)
+			close(out)
+			// drain the input, so the stages in front of this one can finish
+			for range in {
+			}
+		}(i, stage, in, out)
+		in = out
+	}
+	for line := range in {
+		sink(line)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IncludeFilter passes the lines that match the regular expression of the stage
+func IncludeFilter(args map[string]CmdToken, in <-chan string, out chan<- string) error {
+	return grepFilter(args["include_string"], in, out, true)
+}
+
+// ExcludeFilter passes the lines that don't match the regular expression of the stage
+func ExcludeFilter(args map[string]CmdToken, in <-chan string, out chan<- string) error {
+	return grepFilter(args["exclude_string"], in, out, false)
+}
+
+func grepFilter(patternTok CmdToken, in <-chan string, out chan<- string, include bool) error {
+	pattern, _ := patternTok.Value.(string)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	for line := range in {
+		if re.MatchString(line) == include {
+			out <- line
+		}
+	}
+	return nil
+}
+
+// CountFilter replaces the lines with the number of lines
+func CountFilter(args map[string]CmdToken, in <-chan string, out chan<- string) error {
+	count := 0
+	for range in {
+		count++
+	}
+	out <- strconv.Itoa(count)
+	return nil
+}
+
+// HeadFilter passes the first n lines
+func HeadFilter(args map[string]CmdToken, in <-chan string, out chan<- string) error {
+	limit, _ := args["head_int"].Value.(int)
+	for line := range in {
+		if limit <= 0 {
+			break
+		}
+		out <- line
+		limit--
+	}
+	return nil
+}
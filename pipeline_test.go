@@ -0,0 +1,91 @@
+package cmdparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "show" "feature" "translation" `,
+	})
+	p.RegisterStandardFilters()
+	p.SetInputString(`show feature translation | include "de|it" | exclude "draft" | count`)
+	Assert(t, p.Parse(), "Should match input string, but does not!")
+	Assert(t, len(p.Stages) == 3, "Expected 3 filter stages")
+	Assert(t, p.ParseResult["start_translation"].Text == "translation", "Command results must not be replaced by the stages")
+	Assert(t, p.Stages[0].ParseResult["include_string"].Value == "de|it", "Wrong include pattern")
+
+	source := make(chan string)
+	go func() {
+		for _, line := range []string{"de: Haus", "it: casa", "fr: maison", "de: Entwurf draft"} {
+			source <- line
+		}
+		close(source)
+	}()
+	output := []string{}
+	err := p.RunPipeline(source, func(line string) { output = append(output, line) })
+	Assert(t, err == nil, "Unexpected pipeline error")
+	Assert(t, len(output) == 1 && output[0] == "2", "Expected a count of 2")
+}
+
+func TestPipelineErrors(t *testing.T) {
+	data := []struct {
+		Input  string
+		Column int
+	}{
+		{Input: `show feature | grep "x"`, Column: 16},
+		{Input: `show feature | head "x"`, Column: 16},
+		{Input: `show feature | `, Column: 0},
+	}
+	for _, entry := range data {
+		p := NewParser()
+		p.SetCommandGrammar(map[string]string{
+			"START": ` "show" "feature" `,
+		})
+		p.RegisterStandardFilters()
+		p.SetInputString(entry.Input)
+		Assert(t, !p.Parse(), "Should not match "+entry.Input)
+		errs := p.Errors()
+		Assert(t, len(errs) > 0 && errs[len(errs)-1].Column == entry.Column, "Wrong error position for "+entry.Input)
+	}
+
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "show" "feature" `,
+	})
+	p.SetInputString(`show feature | count`)
+	Assert(t, !p.Parse(), "Without filters the pipe char is a normal char")
+	p.RegisterStandardFilters()
+	source := make(chan string, 3)
+	source <- "a"
+	source <- "b"
+	source <- "c"
+	close(source)
+	p.SetInputString(`show feature | head 1`)
+	Assert(t, p.Parse(), "Should match head filter")
+	output := []string{}
+	p.RunPipeline(source, func(line string) { output = append(output, line) })
+	Assert(t, len(output) == 1 && output[0] == "a", "Expected the first line only")
+
+	p.SetInputString(`show feature | include "a" | head abc`)
+	Assert(t, !p.Parse() && len(p.Stages) == 1, "Expected only the matching stages")
+	err := p.RunPipeline(source, func(line string) { t.Error("Unexpected output " + line) })
+	Assert(t, errors.Is(err, ErrNoMatch), "Expected no pipeline to run without a match")
+
+	err = p.RegisterStandardFilters()
+	Assert(t, errors.Is(err, ErrDuplicateRule) && err.Error() == "filter include: DUPLICATE_RULE", "Expected the error of the first filter")
+
+	err = p.RegisterFilter("tail", `"tail" !int`, nil)
+	Assert(t, errors.Is(err, ErrMissingFilterFunc) && err.Error() == "filter tail: MISSING_FILTER_FUNC", "Expected a filter without a function to be rejected")
+	_, registered := p.filters["tail"]
+	Assert(t, !registered, "Expected no rule for the rejected filter")
+
+	// a rule of the grammar with the name of a filter
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{"START": `"show" count`, "count": `!int`})
+	Assert(t, p.RegisterStandardFilters() == nil, "Expected the filters next to the grammar rules")
+	p.SetInputString(`show 3 | count | head 1`)
+	Assert(t, p.Parse() && p.ParseResult["count_int"].Value == 3 && p.Stages[1].ParseResult["head_int"].Value == 1, "Expected the grammar rule and the filters")
+}
@@ -0,0 +1,266 @@
+package cmdparser
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+// ANSI colors of the terminal view of a trace
+const (
+	colorReset  = "\x1b[0m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorDim    = "\x1b[2m"
+)
+
+// Trace to implement the Tracer interface for the TraceRecorder
+func (recorder *TraceRecorder) Trace(event TraceEvent) {
+	switch event.Type {
+	case TraceEnterRule, TraceTryItem:
+		node := &TraceNode{Event: event}
+		recorder.add(node)
+		recorder.stack = append(recorder.stack, node)
+	case TraceExitRule, TraceMatch, TraceFail:
+		if len(recorder.stack) == 0 {
+			return
+		}
+		node := recorder.stack[len(recorder.stack)-1]
+		node.Event.End, node.Event.Match = event.End, event.Match
+		recorder.stack = recorder.stack[:len(recorder.stack)-1]
+	default:
+		recorder.add(&TraceNode{Event: event})
+	}
+}
+
+// add appends a step to the step that is currently recorded, or as a root
+func (recorder *TraceRecorder) add(node *TraceNode) {
+	if len(recorder.stack) == 0 {
+		recorder.Roots = append(recorder.Roots, node)
+		return
+	}
+	parent := recorder.stack[len(recorder.stack)-1]
+	parent.Children = append(parent.Children, node)
+}
+
+// FailedAt returns the step that failed at the last token, the step itself or
+// one below it. This is where the input went wrong, even if a choice matched
+// later. It is nil if no step failed.
+func (node *TraceNode) FailedAt() *TraceNode {
+	var result *TraceNode
+	if !node.Event.Match && (node.Event.Type == TraceEnterRule || node.Event.Type == TraceTryItem) {
+		result = node
+	}
+	for _, child := range node.Children {
+		if failed := child.FailedAt(); failed != nil && (result == nil || failed.Event.Pos > result.Event.Pos) {
+			result = failed
+		}
+	}
+	return result
+}
+
+// steps returns the children of a step. An item that calls a rule has the
+// steps of the rule as its own, so a rule call is a single step.
+func steps(node *TraceNode) []*TraceNode {
+	if node.Event.Type == TraceTryItem && len(node.Children) == 1 && node.Children[0].Event.Type == TraceEnterRule {
+		return node.Children[0].Children
+	}
+	return node.Children
+}
+
+// TraceInput parses an input with a TraceRecorder and returns the recorded
+// steps and the parse tree. A tracer set with SetTracer does not get the events.
+func (theParser *CommandParser) TraceInput(input string) (*TraceReport, error) {
+	if err := theParser.SetInputString(input); err != nil {
+		return nil, err
+	}
+	recorder := &TraceRecorder{}
+	tracer := theParser.tracer
+	theParser.SetTracer(recorder)
+	defer theParser.SetTracer(tracer)
+	report := &TraceReport{Input: input, Match: theParser.Parse(), Trace: recorder.Roots, Tree: theParser.ParseTree()}
+	report.tokens = theParser.Tokens()
+	return report, nil
+}
+
+// label describes a step, the rule, the item as it is written in the grammar
+// or where the parser went back to
+func label(node *TraceNode) string {
+	switch node.Event.Type {
+	case TraceEnterRule:
+		return node.Event.Rule
+	case TraceTryItem:
+		return node.Event.Item
+	case TraceBacktrack:
+		return "backtrack to " + tokenText(node.Event.Token)
+	}
+	return "input left at " + tokenText(node.Event.Token)
+}
+
+// span returns the text of the tokens a step matched
+func (report *TraceReport) span(node *TraceNode) string {
+	if node.Event.Token == nil {
+		return ""
+	}
+	for i, tok := range report.tokens {
+		if tok == node.Event.Token {
+			texts := []string{}
+			for _, matched := range report.tokens[i : i+node.Event.End-node.Event.Pos] {
+				texts = append(texts, matched.Text)
+			}
+			return strings.Join(texts, " ")
+		}
+	}
+	return ""
+}
+
+// result describes how a step ended and the color of the description
+func (report *TraceReport) result(node *TraceNode) (string, string) {
+	switch {
+	case node.Event.Type == TraceBacktrack || node.Event.Type == TraceInputLeft:
+		return "", colorYellow
+	case node.Event.Match:
+		return "matched " + report.span(node), colorGreen
+	}
+	failed := node.FailedAt()
+	if failed == node || failed.Event.Type == TraceEnterRule {
+		return "failed at " + tokenText(node.Event.Token), colorRed
+	}
+	return "failed at " + tokenText(failed.Event.Token) + ", expected " + failed.Event.Item, colorRed
+}
+
+// WriteText writes the trace as an indented tree of steps followed by the
+// parse tree, with color the steps are colored like a terminal shows them
+func (report *TraceReport) WriteText(w io.Writer, color bool) error {
+	var b strings.Builder
+	paint := func(s, c string) string {
+		if !color || s == "" {
+			return s
+		}
+		return c + s + colorReset
+	}
+	var writeStep func(node *TraceNode, depth int)
+	writeStep = func(node *TraceNode, depth int) {
+		text, c := report.result(node)
+		b.WriteString(strings.Repeat("  ", depth) + paint(label(node), c))
+		if text != "" {
+			b.WriteString(" " + paint(text, colorDim))
+		}
+		b.WriteString("\n")
+		for _, child := range steps(node) {
+			writeStep(child, depth+1)
+		}
+	}
+	var writeNode func(node *ParseNode, depth int)
+	writeNode = func(node *ParseNode, depth int) {
+		b.WriteString(strings.Repeat("  ", depth) + node.Name)
+		if node.Token != nil && node.Token.Type != TokenList {
+			b.WriteString(" = " + paint(node.Token.Text, colorGreen))
+		}
+		b.WriteString("\n")
+		for _, child := range node.Children {
+			writeNode(child, depth+1)
+		}
+	}
+
+	b.WriteString("input: " + report.Input + "\n")
+	for _, node := range report.Trace {
+		writeStep(node, 0)
+	}
+	if report.Tree == nil {
+		b.WriteString(paint("no match", colorRed) + "\n")
+	} else {
+		b.WriteString("parse tree:\n")
+		writeNode(report.Tree, 1)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// htmlStep is a step of the trace in the HTML report
+type htmlStep struct {
+	Label    string
+	Result   string
+	Class    string
+	Children []*htmlStep
+}
+
+// htmlFailure is a failed item in the table of the HTML report
+type htmlFailure struct {
+	Rule, Item, Token string
+}
+
+// htmlReport is the data of the HTML report template
+type htmlReport struct {
+	*TraceReport
+	Steps    []*htmlStep
+	Failures []htmlFailure
+}
+
+// htmlClasses are the CSS classes of the steps by their color
+var htmlClasses = map[string]string{colorGreen: "match", colorRed: "fail", colorYellow: "back"}
+
+// WriteHTML writes the trace and the parse tree as a HTML page without
+// external resources. Failed steps are collapsed, the failed items are listed
+// with the token they failed at.
+func (report *TraceReport) WriteHTML(w io.Writer) error {
+	data := &htmlReport{TraceReport: report}
+	listed := map[htmlFailure]bool{}
+	var convert func(node *TraceNode) *htmlStep
+	convert = func(node *TraceNode) *htmlStep {
+		text, c := report.result(node)
+		step := &htmlStep{Label: label(node), Result: text, Class: htmlClasses[c]}
+		failure := htmlFailure{node.Event.Rule, node.Event.Item, tokenText(node.Event.Token)}
+		if node.Event.Type == TraceTryItem && !node.Event.Match && len(node.Children) == 0 && !listed[failure] {
+			data.Failures = append(data.Failures, failure)
+			listed[failure] = true
+		}
+		for _, child := range steps(node) {
+			step.Children = append(step.Children, convert(child))
+		}
+		return step
+	}
+	for _, node := range report.Trace {
+		data.Steps = append(data.Steps, convert(node))
+	}
+	return reportTemplate.Execute(w, data)
+}
+
+// reportTemplate is the template of the HTML report, see WriteHTML
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>cmdparser trace: {{.Input}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+code, summary, li { font-family: monospace; }
+ul { list-style: none; padding-left: 1.5em; border-left: 1px dotted #ccc; }
+.match > summary, span.match { color: #080; }
+.fail > summary, span.fail { color: #c00; }
+.back { color: #a70; }
+.result { color: #777; margin-left: 1em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1><code>{{.Input}}</code></h1>
+<p>{{if .Match}}<span class="match">match</span>{{else}}<span class="fail">no match</span>{{end}}</p>
+<h2>Trace</h2>
+<ul>{{range .Steps}}{{template "step" .}}{{end}}</ul>
+{{with .Failures}}<h2>Failed Items</h2>
+<table>
+<tr><th>Rule</th><th>Item</th><th>Token</th></tr>
+{{range .}}<tr><td>{{.Rule}}</td><td>{{.Item}}</td><td>{{.Token}}</td></tr>
+{{end}}</table>
+{{end}}{{with .Tree}}<h2>Parse Tree</h2>
+<ul>{{template "node" .}}</ul>
+{{end}}</body>
+</html>
+{{define "step"}}<li>{{if .Children}}<details class="{{.Class}}"{{if ne .Class "fail"}} open{{end}}><summary>{{.Label}}<span class="result">{{.Result}}</span></summary>
+<ul>{{range .Children}}{{template "step" .}}{{end}}</ul></details>{{else}}<span class="{{.Class}}">{{.Label}}</span><span class="result">{{.Result}}</span>{{end}}</li>
+{{end}}{{define "node"}}<li>{{.Name}}{{if .Token}}{{if .Children}}{{else}} = <span class="match">{{.Token.Text}}</span>{{end}}{{end}}{{with .Children}}
+<ul>{{range .}}{{template "node" .}}{{end}}</ul>{{end}}</li>
+{{end}}`))
@@ -0,0 +1,63 @@
+package cmdparser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTraceRecorder(t *testing.T) {
+	recorder := &TraceRecorder{}
+	p := NewParser()
+	p.SetCommandGrammar(arithmeticGrammar)
+	p.SetTracer(recorder)
+	p.SetInputString(`calc 1 * 2`)
+	Assert(t, p.Parse(), "Expected a match")
+	Assert(t, len(recorder.Roots) == 1 && recorder.Roots[0].Event.Rule == "START", "Expected START as the root")
+	root := recorder.Roots[0]
+	Assert(t, root.Event.Match && root.Event.End == 4, "Expected START to match all tokens")
+	Assert(t, len(root.Children) == 2 && root.Children[0].Event.Item == `"calc"`, "Expected the items of START below it")
+	Assert(t, root.FailedAt().Event.Item == "'*'" && root.FailedAt().Event.Token == nil, "Expected '*' to fail at the end of the input")
+
+	recorder.Roots = nil
+	p.SetInputString(`calc (1 * x)`)
+	Assert(t, !p.Parse(), "Expected no match")
+	root = recorder.Roots[0]
+	Assert(t, !root.Event.Match && root.FailedAt().Event.Token.Text == "x", "Expected START to fail at x")
+
+	recorder.Roots = nil
+	p.SetInputString(`calc 1 x`)
+	Assert(t, !p.Parse(), "Expected no match")
+	Assert(t, len(recorder.Roots) == 2 && recorder.Roots[1].Event.Type == TraceInputLeft, "Expected the input left after START")
+}
+
+func TestTraceReport(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	report, err := p.TraceInput(`grant reader to alice`)
+	Assert(t, err == nil && report.Match && report.Tree != nil, "Expected a match")
+
+	var out bytes.Buffer
+	report.WriteText(&out, false)
+	text := out.String()
+	Assert(t, strings.HasPrefix(text, "input: grant reader to alice\nSTART matched grant reader to alice\n"), "Expected the input and START")
+	Assert(t, strings.Contains(text, "  GrantRole matched grant reader to alice\n"), "Expected a rule call as a single step")
+	Assert(t, strings.Contains(text, "parse tree:\n  START\n"), "Expected the parse tree")
+	Assert(t, !strings.Contains(text, "\x1b["), "Expected no colors")
+
+	out.Reset()
+	report.WriteText(&out, true)
+	Assert(t, strings.Contains(out.String(), colorGreen+"START"+colorReset), "Expected a green match")
+
+	report, _ = p.TraceInput(`grant reader from alice`)
+	Assert(t, !report.Match && report.Tree == nil, "Expected no match")
+	out.Reset()
+	report.WriteHTML(&out)
+	html := out.String()
+	Assert(t, strings.HasPrefix(html, "<!DOCTYPE html>") && !strings.Contains(html, "<script src") && !strings.Contains(html, "<link"), "Expected a page without external resources")
+	Assert(t, strings.Contains(html, `<td>GrantRole</td><td>&#34;to&#34;</td><td>from at 1:14</td>`), "Expected the failed keyword in the table")
+	Assert(t, !strings.Contains(html, "Parse Tree"), "Expected no parse tree without a match")
+
+	_, err = p.TraceInput(`grant "reader`)
+	Assert(t, err != nil, "Expected the tokenizer error")
+}
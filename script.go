@@ -0,0 +1,119 @@
+package cmdparser
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// ParseScript parses every statement of a script. Statements are separated by
+// newlines or STATEMENTSEPARATOR, a trailing backslash continues a statement on
+// the next line. Blank lines and comments are skipped. If the reader has a Name
+// method, like os.File, the name is used in the error messages.
+// The returned error is the first statement error or a read error.
+func (theParser *CommandParser) ParseScript(r io.Reader) ([]*StatementResult, error) {
+	name := "<input>"
+	if named, ok := r.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	results := []*StatementResult{}
+	var firstErr error
+	lines := strings.Split(string(data), "\n")
+	for lineNo := 0; lineNo < len(lines); lineNo++ {
+		startLine := lineNo + 1
+		logical := strings.TrimSuffix(lines[lineNo], "\r")
+		for strings.HasSuffix(logical, "\\") && lineNo+1 < len(lines) {
+			// replace the backslash with a blank to keep the columns
+			lineNo++
+			logical = logical[:len(logical)-1] + " \n" + strings.TrimSuffix(lines[lineNo], "\r")
+		}
+		for _, result := range theParser.parseLine(name, startLine, logical) {
+			if result.Err != nil && firstErr == nil {
+				firstErr = result.Err
+			}
+			results = append(results, result)
+		}
+	}
+	return results, firstErr
+}
+
+// ParseStatements parses an input line with statements separated by
+// STATEMENTSEPARATOR, like `cmd1 ; cmd2`, and returns a result per statement.
+// The returned error is the first statement error. SetInputString and Parse
+// take a single statement.
+func (theParser *CommandParser) ParseStatements(input string) ([]*StatementResult, error) {
+	results := theParser.parseLine("<input>", 1, input)
+	for _, result := range results {
+		if result.Err != nil {
+			return results, result.Err
+		}
+	}
+	return results, nil
+}
+
+// parseLine tokenizes a logical line of a script and parses each of its statements
+func (theParser *CommandParser) parseLine(name string, startLine int, line string) []*StatementResult {
+	tokens, err := theParser.tokenize(line)
+	if err != nil {
+		result := &StatementResult{File: name, Line: startLine, Column: 1, Text: strings.TrimSpace(line)}
+		var tokErr *TokenError
+		if errors.As(err, &tokErr) {
+			result.Line = startLine + tokErr.Position.Line - 1
+			result.Column = tokErr.Position.Column
+		}
+		result.Err = &ScriptError{File: name, Line: result.Line, Column: result.Column, Err: err}
+		return []*StatementResult{result}
+	}
+	// the tokens may be shared, by aliases or by the tokenizer, so the
+	// positions are moved on copies
+	moved := make([]*CmdToken, len(tokens))
+	for i, tok := range tokens {
+		tok = copyToken(tok)
+		tok.Position.Filename = name
+		tok.Position.Line += startLine - 1
+		if tok.End.Line > 0 {
+			tok.End.Filename = name
+			tok.End.Line += startLine - 1
+		}
+		moved[i] = tok
+	}
+	tokens = moved
+
+	results := []*StatementResult{}
+	for _, statement := range splitTokens(tokens, STATEMENTSEPARATOR) {
+		if len(statement) > 0 {
+			results = append(results, theParser.parseStatement(line, statement))
+		}
+	}
+	return results
+}
+
+// parseStatement parses the tokens of a single statement
+func (theParser *CommandParser) parseStatement(line string, tokens []*CmdToken) *StatementResult {
+	first, last := tokens[0], tokens[len(tokens)-1]
+	result := &StatementResult{
+		File:   first.Position.Filename,
+		Line:   first.Position.Line,
+		Column: first.Position.Column,
+	}
+	if last.End.Offset > first.Position.Offset && last.End.Offset <= len(line) {
+		result.Text = line[first.Position.Offset:last.End.Offset]
+	} else {
+		texts := []string{}
+		for _, tok := range tokens {
+			texts = append(texts, tok.Text)
+		}
+		result.Text = strings.Join(texts, " ")
+	}
+	theParser.SetTokens(tokens)
+	result.IsMatch = theParser.Parse()
+	result.ParseResult = theParser.ParseResult
+	if !result.IsMatch {
+		result.Err = &ScriptError{File: result.File, Line: result.Line, Column: result.Column, Err: ErrNoMatch}
+	}
+	return result
+}
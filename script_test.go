@@ -0,0 +1,125 @@
+package cmdparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var scriptGrammar = map[string]string{
+	"START":    ` "show" "feature" !string? ToClause? `,
+	"ToClause": ` "to"  !string `,
+}
+
+func TestParseScript(t *testing.T) {
+	script := `# export all features
+show feature "de" ; show feature "it" to "/tmp/it.csv"
+
+show feature \
+    to "/tmp/all.csv"   # continued line
+show feature "fr" ;;
+`
+	p := NewParser()
+	p.SetCommandGrammar(scriptGrammar)
+	results, err := p.ParseScript(strings.NewReader(script))
+	Assert(t, err == nil, "Unexpected script error")
+	Assert(t, len(results) == 4, "Expected 4 statements")
+	if len(results) != 4 {
+		return
+	}
+	Assert(t, results[0].Line == 2 && results[0].Column == 1, "Wrong position of statement 1")
+	Assert(t, results[1].Line == 2 && results[1].Column == 21, "Wrong position of statement 2")
+	Assert(t, results[1].Text == `show feature "it" to "/tmp/it.csv"`, "Wrong text of statement 2")
+	Assert(t, results[1].ParseResult["toclause_string"].Value == "/tmp/it.csv", "Wrong result of statement 2")
+	Assert(t, results[2].Line == 4 && results[2].ParseResult["toclause_string"].Position.Line == 5, "Continued line has wrong positions")
+	Assert(t, results[3].IsMatch && results[3].ParseResult["start_string"].Value == "fr", "Wrong result of statement 4")
+	_, leaked := results[3].ParseResult["toclause_string"]
+	Assert(t, !leaked, "Results of a statement must not leak into the next one")
+}
+
+// cachedTokenizer returns the same tokens for the same line
+type cachedTokenizer struct {
+	cache map[string][]*CmdToken
+}
+
+func (tokenizer *cachedTokenizer) Tokenize(line string) ([]*CmdToken, error) {
+	if tokens, ok := tokenizer.cache[line]; ok {
+		return tokens, nil
+	}
+	tokens, err := NewDefaultTokenizer().Tokenize(line)
+	tokenizer.cache[line] = tokens
+	return tokens, err
+}
+
+func TestParseScriptSharedTokens(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(scriptGrammar)
+	p.SetTokenizer(&cachedTokenizer{cache: map[string][]*CmdToken{}})
+	results, err := p.ParseScript(strings.NewReader("\nshow feature\nshow feature\n"))
+	Assert(t, err == nil && len(results) == 2, "Expected 2 statements")
+	Assert(t, results[0].Line == 2 && results[1].Line == 3, "Expected the positions of the shared tokens to be moved once per line")
+
+	Assert(t, p.SetInputString(`show feature "de" ; show feature "it"`) == nil, "Unexpected tokenizer error")
+	Assert(t, !p.Parse(), "Expected ; to be no statement separator in a single input")
+}
+
+func TestParseStatements(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(scriptGrammar)
+	results, err := p.ParseStatements(`show feature "de" ; show feature "it" to "/tmp/it.csv"`)
+	Assert(t, err == nil && len(results) == 2, "Expected 2 statements")
+	Assert(t, results[1].Column == 21 && results[1].ParseResult["toclause_string"].Value == "/tmp/it.csv", "Wrong result of statement 2")
+
+	results, err = p.ParseStatements(`show feature ; show features`)
+	Assert(t, len(results) == 2 && results[0].IsMatch && !results[1].IsMatch, "Expected the second statement to fail")
+	Assert(t, err != nil && err.Error() == "<input>:1:16: NO_MATCH", "Unexpected error message")
+
+	_, err = p.ParseStatements(`show "open`)
+	var scriptErr *ScriptError
+	Assert(t, errors.As(err, &scriptErr) && scriptErr.Column == 6, "Expected the column of the tokenizer error")
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.cmds")
+	script := "show feature \"de\"\nshow features\nshow feature \"open\n"
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p := NewParser()
+	p.SetCommandGrammar(scriptGrammar)
+	results, err := p.ParseScript(f)
+	Assert(t, len(results) == 3, "Expected 3 statements")
+	Assert(t, err != nil && err.Error() == path+":2:1: NO_MATCH", "Unexpected error message")
+	Assert(t, results[0].Err == nil && results[0].IsMatch, "Statement 1 should match")
+	var scriptErr *ScriptError
+	Assert(t, errors.As(results[2].Err, &scriptErr) && scriptErr.Line == 3 && scriptErr.Column == 14, "Wrong position for tokenizer error")
+	Assert(t, errors.Is(results[2].Err, ErrUnterminatedString), "Expected unterminated string error")
+}
+
+// BenchmarkParseScript shows that the time per statement does not grow with the script
+func BenchmarkParseScript(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		var sb strings.Builder
+		for i := 0; i < size; i++ {
+			sb.WriteString(`show feature "de" to "/tmp/test.csv"` + "\n")
+		}
+		script := sb.String()
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			p := NewParser()
+			p.SetCommandGrammar(scriptGrammar)
+			p.SetOptions(OptionMemoize)
+			for i := 0; i < b.N; i++ {
+				p.ParseScript(strings.NewReader(script))
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package cmdparser
+
+import (
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+)
+
+// scanExpr is the pretoken type for a complete expression including its delimiters
+const scanExpr = -100
+
+// NewDefaultTokenizer creates the tokenizer that is used if no other tokenizer is set
+func NewDefaultTokenizer() *DefaultTokenizer {
+	return &DefaultTokenizer{
+		Delimiters: append([]ExprDelimiter{}, DefaultDelimiters...),
+	}
+}
+
+// delimiters returns the expression delimiters of the tokenizer
+func (theTokenizer *DefaultTokenizer) delimiters() []ExprDelimiter {
+	if theTokenizer.Delimiters == nil {
+		return DefaultDelimiters
+	}
+	return theTokenizer.Delimiters
+}
+
+// delimiter returns the expression delimiter that is opened by the scanner token
+func (theTokenizer *DefaultTokenizer) delimiter(tok rune) (ExprDelimiter, bool) {
+	for _, d := range theTokenizer.delimiters() {
+		if d.Open == tok {
+			return d, true
+		}
+	}
+	return ExprDelimiter{}, false
+}
+
+// lineStarts returns the offsets of the lines in the input, used to compute positions
+func lineStarts(line string) []int {
+	result := []int{0}
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\n' {
+			result = append(result, i+1)
+		}
+	}
+	return result
+}
+
+// positionAt converts a byte offset of the input into a scanner position
+func positionAt(line string, lines []int, offset int) scanner.Position {
+	l := len(lines) - 1
+	for l > 0 && lines[l] > offset {
+		l--
+	}
+	return scanner.Position{
+		Offset: offset,
+		Line:   l + 1,
+		Column: utf8.RuneCountInString(line[lines[l]:offset]) + 1,
+	}
+}
+
+// captureExpression finds the closing delimiter for the expression starting at
+// offset start. Brackets may be nested, quoted strings are skipped, so they may
+// contain the delimiters. Returns the offset of the closing delimiter.
+func captureExpression(line string, start int, d ExprDelimiter) (int, bool) {
+	depth := 1
+	i := start + utf8.RuneLen(d.Open)
+	for i < len(line) {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == d.Close:
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		case r == d.Open:
+			depth++
+		case r == '"' || r == '\'' || r == '`':
+			// skip the quoted string, honoring backslash escapes
+			i += size
+			for i < len(line) && rune(line[i]) != r {
+				if line[i] == '\\' && r != '`' {
+					i++
+				}
+				i++
+			}
+			if i >= len(line) {
+				return i, false
+			}
+			size = 1
+		}
+		i += size
+	}
+	return i, false
+}
+
+// golangTokenizer uses the go scanner to split line[start:end] into pretokens.
+// If expressions is set, expression delimiters are recognized and a comment
+// ends the scan.
+func (theTokenizer *DefaultTokenizer) golangTokenizer(line string, lines []int, start, end int, expressions bool) ([]*PreToken, error) {
+	var theScanner scanner.Scanner
+	result := []*PreToken{}
+	base := start
+	basePos := positionAt(line, lines, base)
+	initScanner := func() {
+		theScanner.Init(strings.NewReader(line[base:end]))
+		// errors show up as invalid tokens, which are reported by Tokenize
+		theScanner.Error = func(s *scanner.Scanner, msg string) {}
+		theScanner.Mode = scanner.ScanFloats | scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings
+	}
+	initScanner()
+	tok := theScanner.Scan()
+	for tok != scanner.EOF && (tok != COMMENTCHAR || !expressions) {
+		offset := base + theScanner.Position.Offset
+		// the scanner counts lines and columns from base
+		position := scanner.Position{Offset: offset, Line: basePos.Line + theScanner.Position.Line - 1, Column: theScanner.Position.Column}
+		if theScanner.Position.Line == 1 {
+			position.Column += basePos.Column - 1
+		}
+		theToken := &PreToken{
+			Type:     tok,
+			Text:     theScanner.TokenText(),
+			Position: position,
+		}
+		if d, ok := theTokenizer.delimiter(tok); ok && expressions {
+			closing, found := captureExpression(line[:end], offset, d)
+			if !found {
+				err := ErrUnterminatedExpression
+				if d.Open == '\'' && d.Close == '\'' {
+					// the single quoted expressions keep their own error
+					err = ErrMissingSingleQuote
+				}
+				return nil, &TokenError{Position: theToken.Position, Text: line[offset:end], Err: err}
+			}
+			// continue scanning behind the expression, the go scanner would
+			// get confused by quotes of the expression language
+			base = closing + utf8.RuneLen(d.Close)
+			theToken.Type = scanExpr
+			theToken.Text = line[offset:base]
+			basePos = positionAt(line, lines, base)
+			initScanner()
+		}
+		result = append(result, theToken)
+		tok = theScanner.Scan()
+	}
+	return result, nil
+}
+
+// newTokenError creates the error for a pretoken that could not be converted
+func newTokenError(preToken *PreToken, err error) *TokenError {
+	return &TokenError{Position: preToken.Position, Text: preToken.Text, Err: err}
+}
+
+// boolWords returns the words that are read as booleans
+func (theTokenizer *DefaultTokenizer) boolWords() map[string]bool {
+	if theTokenizer.BoolWords == nil {
+		return DefaultBoolWords
+	}
+	return theTokenizer.BoolWords
+}
+
+func (theTokenizer *DefaultTokenizer) tokenFromIdentifier(preToken *PreToken) (*CmdToken, error) {
+	low := strings.ToLower(preToken.Text)
+	token := &CmdToken{
+		Position: preToken.Position,
+	}
+	var err error
+	// process booleans
+	if val, ok := theTokenizer.boolWords()[low]; ok {
+		token.Text = low
+		token.Type = TokenBool
+		token.Value = val
+	} else {
+		token.Text = preToken.Text
+		token.Type = TokenIdent
+		token.Value = preToken.Text
+	}
+	return token, err
+}
+
+func tokenFromInt(preToken *PreToken) (*CmdToken, error) {
+	var err error
+	token := &CmdToken{
+		Text:     preToken.Text,
+		Type:     TokenInt,
+		Position: preToken.Position,
+	}
+	val, err := strconv.Atoi(preToken.Text)
+	if err == nil {
+		token.Value = val
+	} else {
+		token.Value = nil
+		token.Type = TokenERR
+		err = newTokenError(preToken, ErrNotAnInt)
+	}
+	return token, err
+}
+
+func tokenFromFloat(preToken *PreToken) (*CmdToken, error) {
+	var err error
+	token := &CmdToken{
+		Text:     preToken.Text,
+		Type:     TokenFloat,
+		Position: preToken.Position,
+	}
+	val, err := strconv.ParseFloat(preToken.Text, 64)
+	if err == nil {
+		token.Value = val
+	} else {
+		token.Value = nil
+		token.Type = TokenERR
+		err = newTokenError(preToken, ErrNotAFloat)
+	}
+	return token, err
+}
+
+func tokenFromString(preToken *PreToken) (*CmdToken, error) {
+	var err error
+	token := &CmdToken{
+		Text:     preToken.Text,
+		Type:     TokenString,
+		Position: preToken.Position,
+	}
+	val, err := strconv.Unquote(preToken.Text)
+	if err == nil {
+		token.Value = val
+	} else {
+		token.Value = nil
+		token.Type = TokenERR
+		err = newTokenError(preToken, ErrCouldNotUnquote)
+		// the go scanner returns the partial literal if the closing quote is missing
+		quote := preToken.Text[0]
+		if len(preToken.Text) < 2 || preToken.Text[len(preToken.Text)-1] != quote {
+			err = newTokenError(preToken, ErrUnterminatedString)
+		}
+	}
+	return token, err
+}
+
+func tokenFromChar(preToken *PreToken) (*CmdToken, error) {
+	var err error
+	token := &CmdToken{
+		Text:     preToken.Text,
+		Type:     TokenChar,
+		Position: preToken.Position,
+	}
+	r, _ := utf8.DecodeRuneInString(preToken.Text)
+	token.Value = r
+	return token, err
+}
+
+// tokenFromExpression creates the expression token from the complete expression
+// pretoken. The text of the token is the exact source between the delimiters,
+// the value holds the pretokens of the expression.
+func (theTokenizer *DefaultTokenizer) tokenFromExpression(line string, lines []int, preToken *PreToken) (*CmdToken, error) {
+	open, openSize := utf8.DecodeRuneInString(preToken.Text)
+	d, _ := theTokenizer.delimiter(open)
+	start := preToken.Position.Offset + openSize
+	end := preToken.Position.Offset + len(preToken.Text) - utf8.RuneLen(d.Close)
+	inner, err := theTokenizer.golangTokenizer(line, lines, start, end, false)
+	token := &CmdToken{
+		Text:     line[start:end],
+		Type:     TokenExpr,
+		Value:    inner,
+		Position: preToken.Position,
+	}
+	return token, err
+}
+
+// Tokenize creates the list of CmdParser tokens. to make things easier
+// we first use the internal scanner from GO, then post-process the tokens from the scanner.
+func (theTokenizer *DefaultTokenizer) Tokenize(line string) ([]*CmdToken, error) {
+	lines := lineStarts(line)
+	preTokens, err := theTokenizer.golangTokenizer(line, lines, 0, len(line), true)
+	if err != nil {
+		return nil, err
+	}
+	postTokens := []*CmdToken{}
+	var postTok *CmdToken
+	for _, tok := range preTokens {
+		switch tok.Type {
+		case scanner.Ident:
+			postTok, err = theTokenizer.tokenFromIdentifier(tok)
+		case scanner.Int:
+			postTok, err = tokenFromInt(tok)
+		case scanner.Float:
+			postTok, err = tokenFromFloat(tok)
+		case scanner.String:
+			postTok, err = tokenFromString(tok)
+		case scanExpr:
+			postTok, err = theTokenizer.tokenFromExpression(line, lines, tok)
+		default:
+			postTok, err = tokenFromChar(tok)
+		}
+		if err != nil {
+			// an invalid token invalidates the whole command
+			return nil, err
+		}
+		postTok.End = tok.Position
+		postTok.End.Offset += len(tok.Text)
+		if strings.Contains(tok.Text, "\n") {
+			postTok.End = positionAt(line, lines, postTok.End.Offset)
+		} else {
+			postTok.End.Column += utf8.RuneCountInString(tok.Text)
+		}
+		postTokens = append(postTokens, postTok)
+	}
+	return postTokens, nil
+}
@@ -0,0 +1,118 @@
+package cmdparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// String to implement Stringer interface for the TraceEventType
+func (eventType TraceEventType) String() string {
+	switch eventType {
+	case TraceEnterRule:
+		return "enter"
+	case TraceExitRule:
+		return "exit"
+	case TraceTryItem:
+		return "try"
+	case TraceMatch:
+		return "match"
+	case TraceFail:
+		return "fail"
+	case TraceBacktrack:
+		return "backtrack"
+	case TraceInputLeft:
+		return "input-left"
+	}
+	return "event " + strconv.Itoa(int(eventType))
+}
+
+// Trace to implement the Tracer interface for the TracerFunc
+func (fn TracerFunc) Trace(event TraceEvent) {
+	fn(event)
+}
+
+// SetTracer sets the tracer that receives the events of the parser, nil turns
+// tracing off. Without a tracer, OptionDebug traces to stderr as text.
+func (theParser *CommandParser) SetTracer(tracer Tracer) {
+	theParser.tracer = tracer
+}
+
+// NewTextTracer returns a tracer that writes an indented line per event to w
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+// NewJSONTracer returns a tracer that writes a JSON object per event and line to w
+func NewJSONTracer(w io.Writer) Tracer {
+	return &jsonTracer{encoder: json.NewEncoder(w)}
+}
+
+// tokenText describes the token of an event for the text trace
+func tokenText(tok *CmdToken) string {
+	if tok == nil {
+		return "end of input"
+	}
+	return tok.Text + " at " + strconv.Itoa(tok.Position.Line) + ":" + strconv.Itoa(tok.Position.Column)
+}
+
+// Trace to implement the Tracer interface for the textTracer
+func (tracer *textTracer) Trace(event TraceEvent) {
+	indent := strings.Repeat("  ", event.Depth)
+	switch event.Type {
+	case TraceEnterRule:
+		fmt.Fprintln(tracer.w, indent+event.Rule+" at "+tokenText(event.Token))
+	case TraceExitRule:
+		result := "failed"
+		if event.Match {
+			result = "matched"
+		}
+		fmt.Fprintln(tracer.w, indent+event.Rule+" "+result)
+	case TraceTryItem, TraceFail:
+		fmt.Fprintln(tracer.w, indent+event.Type.String()+" "+event.Item+" at "+tokenText(event.Token))
+	case TraceMatch:
+		fmt.Fprintln(tracer.w, indent+"match "+event.Item+" "+tokenText(event.Token))
+	default:
+		fmt.Fprintln(tracer.w, indent+event.Type.String()+" to "+tokenText(event.Token))
+	}
+}
+
+// Trace to implement the Tracer interface for the jsonTracer
+func (tracer *jsonTracer) Trace(event TraceEvent) {
+	e := jsonEvent{Event: event.Type.String(), Rule: event.Rule, Item: event.Item, Pos: event.Pos, End: event.End, Depth: event.Depth, Match: event.Match}
+	if event.Token != nil {
+		e.Token, e.Line, e.Column = event.Token.Text, event.Token.Position.Line, event.Token.Position.Column
+	}
+	tracer.encoder.Encode(e)
+}
+
+// trace sends an event at a position of the input to the tracer, if there is one
+func (theParser *CommandParser) trace(eventType TraceEventType, rule *RuleStruct, item *RuleItem, pos int, match bool) {
+	if theParser.tracer == nil {
+		return
+	}
+	event := TraceEvent{Type: eventType, Rule: rule.Name, Index: -1, Pos: pos, End: theParser.tokenPos, Depth: theParser.traceDepth, Match: match}
+	if item != nil {
+		event.Item = theParser.itemSource(item)
+		for i, ruleItem := range rule.Items {
+			if ruleItem == item {
+				event.Index = i
+			}
+		}
+	}
+	if pos < len(theParser.tokens) {
+		event.Token = theParser.tokens[pos]
+	}
+	theParser.tracer.Trace(event)
+}
+
+// backtrack returns to an earlier position of the input and drops the tokens
+// captured after it
+func (theParser *CommandParser) backtrack(rule *RuleStruct, pos, captures int) {
+	if pos < theParser.tokenPos {
+		theParser.trace(TraceBacktrack, rule, nil, pos, false)
+	}
+	theParser.tokenPos, theParser.captures = pos, theParser.captures[:captures]
+}
@@ -0,0 +1,71 @@
+package cmdparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	events := []TraceEvent{}
+	p := NewParser()
+	p.SetCommandGrammar(arithmeticGrammar)
+	p.SetTracer(TracerFunc(func(event TraceEvent) { events = append(events, event) }))
+	p.SetInputString(`calc 1 - 2`)
+	Assert(t, p.Parse(), "Expected a match")
+	Assert(t, len(events) > 0 && events[0].Type == TraceEnterRule && events[0].Rule == "START", "Expected START to be entered first")
+	last := events[len(events)-1]
+	Assert(t, last.Type == TraceExitRule && last.Rule == "START" && last.Match && last.Depth == 0, "Expected START to be left last")
+
+	depth, backtracks := 0, 0
+	for _, event := range events {
+		switch event.Type {
+		case TraceEnterRule:
+			Assert(t, event.Depth == depth, "Expected the depth of the rule to be the nesting level")
+			depth++
+		case TraceExitRule:
+			depth--
+			Assert(t, event.Depth == depth, "Expected exit at the depth of enter")
+		case TraceBacktrack:
+			Assert(t, event.Pos < event.End, "Expected to backtrack to an earlier token")
+			backtracks++
+		}
+	}
+	Assert(t, depth == 0, "Expected every rule to be left")
+	Assert(t, backtracks > 0, "Expected the alternatives of Expr to backtrack")
+
+	events = events[:0]
+	p.SetInputString(`calc 1 2`)
+	Assert(t, !p.Parse(), "Expected no match")
+	last = events[len(events)-1]
+	Assert(t, last.Type == TraceInputLeft && last.Token.Text == "2", "Expected the input left after the match")
+
+	events = events[:0]
+	p.SetTracer(nil)
+	p.SetInputString(`calc 1`)
+	Assert(t, p.Parse() && len(events) == 0, "Expected no events without a tracer")
+}
+
+func TestTextAndJSONTracer(t *testing.T) {
+	var out bytes.Buffer
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	p.SetTracer(NewTextTracer(&out))
+	p.SetInputString(`grant reader to alice`)
+	Assert(t, p.Parse(), "Expected a match")
+	Assert(t, strings.HasPrefix(out.String(), "START at grant at 1:1\n"), "Expected START at the first token")
+	Assert(t, strings.Contains(out.String(), "  match \"grant\" grant at 1:1\n"), "Expected the keyword to match")
+	Assert(t, strings.HasSuffix(out.String(), "START matched\n"), "Expected START to match")
+
+	out.Reset()
+	p.SetTracer(NewJSONTracer(&out))
+	p.SetInputString(`grant reader to alice`)
+	Assert(t, p.Parse(), "Expected a match")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for _, line := range lines {
+		var event map[string]interface{}
+		Assert(t, json.Unmarshal([]byte(line), &event) == nil && event["event"] != nil, "Expected a JSON object per line: "+line)
+	}
+	Assert(t, strings.HasPrefix(lines[0], `{"event":"enter","rule":"START","token":"grant","line":1,"column":1`), "Expected the first event as JSON: "+lines[0])
+}
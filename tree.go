@@ -0,0 +1,66 @@
+package cmdparser
+
+import "strings"
+
+// ParseTree returns the tree of the rules and tokens of the last match, nil if
+// the input did not match. The root is START, a rule call has the nodes of the
+// items it matched as children, a list has its elements and separators.
+func (theParser *CommandParser) ParseTree() *ParseNode {
+	if !theParser.IsMatch {
+		return nil
+	}
+	return &ParseNode{Name: "START", Children: theParser.treeNodes(theParser.captures)}
+}
+
+// treeNodes returns the nodes of the entries of the captures log. The entries
+// that belong to a rule call or a list become the children of its node.
+func (theParser *CommandParser) treeNodes(log []capture) []*ParseNode {
+	reversed := []*ParseNode{}
+	for end := len(log); end > 0; {
+		c := log[end-1]
+		start := end - 1 - c.children
+		if c.tok != nil {
+			node := &ParseNode{Name: terminal(c.item), Key: resultKey(c.item), Token: c.tok}
+			if c.tok.Type == TokenList {
+				node.Name = theParser.itemSource(c.item)
+			}
+			node.group = c.item.ExprType == SymbolExpr && strings.HasPrefix(c.item.ExprString, c.item.ParentRule.Name+".")
+			node.Children = theParser.treeNodes(log[start : end-1])
+			reversed = append(reversed, node)
+		}
+		end = start
+	}
+	nodes := make([]*ParseNode, len(reversed))
+	for i, node := range reversed {
+		nodes[len(nodes)-1-i] = node
+	}
+	return nodes
+}
+
+// String returns the tree as indented lines, two blanks per level. The token
+// of a node without children is written after its name. The generated rules
+// of groups, like START.2, are left out, their children are written in their
+// place, so the lines don't change when the alternatives are reordered.
+func (node *ParseNode) String() string {
+	var b strings.Builder
+	node.write(&b, 0)
+	return b.String()
+}
+
+// write writes a node and its children at an indentation level
+func (node *ParseNode) write(b *strings.Builder, depth int) {
+	if node.group {
+		for _, child := range node.Children {
+			child.write(b, depth)
+		}
+		return
+	}
+	b.WriteString(strings.Repeat("  ", depth) + node.Name)
+	if node.Token != nil && len(node.Children) == 0 {
+		b.WriteString(" = " + node.Token.Text)
+	}
+	b.WriteString("\n")
+	for _, child := range node.Children {
+		child.write(b, depth+1)
+	}
+}
@@ -0,0 +1,37 @@
+package cmdparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTree(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(arithmeticGrammar)
+	p.SetInputString(`calc 1 - 2 - 3`)
+	Assert(t, p.Parse(), "Expected a match")
+	tree := p.ParseTree()
+	Assert(t, tree.Name == "START" && len(tree.Children) == 2, "Expected calc and Expr below START")
+
+	// (1 - 2) - 3, the failed alternatives are not in the tree
+	expr := tree.Children[1].Children
+	Assert(t, len(expr) == 1 && expr[0].Name == "Expr.2", "Expected the second alternative of Expr")
+	Assert(t, len(expr[0].Children) == 3 && expr[0].Children[2].Token.Text == "3", "Expected the last term at the top")
+	inner := expr[0].Children[0].Children[0]
+	Assert(t, inner.Name == "Expr.2" && inner.Children[2].Token.Text == "2", "Expected 1 - 2 below")
+	Assert(t, !strings.Contains(tree.String(), "Expr.2") && strings.HasPrefix(tree.String(), "START\n  \"calc\" = calc\n  Expr\n    Expr\n      Expr\n"), "Expected the tree without the group rules:\n"+tree.String())
+
+	p.SetCommandGrammar(commandGrammar)
+	p.SetInputString(`grant reader, writer to alice`)
+	Assert(t, p.Parse(), "Expected a match")
+	list := p.ParseTree().Children[0].Children[0].Children[1]
+	Assert(t, list.Name == "!ident % ','" && len(list.Children) == 3, "Expected the elements and the separator of the list")
+	Assert(t, list.Key == "grantrole_ident" && list.Children[2].Token.Text == "writer", "Expected the key of the list and its elements")
+
+	p.SetInputString(`revoke admin from bob`)
+	Assert(t, p.Parse(), "Expected a match")
+	Assert(t, strings.HasPrefix(p.ParseTree().String(), "START\n  Command\n    RevokeRole\n      \"revoke\" = revoke\n"), "Expected the tree as indented lines")
+
+	p.SetInputString(`grant`)
+	Assert(t, !p.Parse() && p.ParseTree() == nil, "Expected no tree without a match")
+}
@@ -1,14 +1,21 @@
 package cmdparser
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"regexp"
 	"strconv"
 	"text/scanner"
 )
 
 // define the various type of a grammar line
 const (
-	Sequence = iota // all items of this sequence must match
-	Choice          // any one match of these items is sufficient
+	Sequence    = iota // all items of this sequence must match
+	Choice             // any one match of these items is sufficient
+	Permutation        // each item at most once, in any order
 )
 
 // GrammarItemType is the type for the type list of the grammar item
@@ -21,8 +28,14 @@ const (
 	ClassExpr
 	SymbolExpr
 	DataTypeExpr
+	FlagExpr
+	PredicateExpr
+	NotPredicateExpr
 )
 
+// Unbounded is the maximum number of occurrences of an item with * or +
+const Unbounded = math.MaxInt32
+
 // GrammarItemCardinality defines how often a token can occur
 type GrammarItemCardinality int
 
@@ -34,19 +47,48 @@ const (
 	CardinalityOne
 )
 
-// OptionDebug activates verbose debug output
+// OptionDebug writes a trace of the parser to stderr, unless a tracer is set
 // OptionIgnorecase is planned to be used to case-insensitive parsing
+// OptionNoInterpolation turns off the replacement of variable references
+// OptionMemoize keeps the result of every rule per input position, see matchRule
+// OptionReserveKeywords reserves all "keyword" literals of the grammar, so !ident doesn't match them
 const (
 	OptionDebug = 1 << iota
 	OptionIgnoreCase
+	OptionNoInterpolation
+	OptionReserveKeywords
+	OptionMemoize
 )
 
 // COMMENTCHAR starts a comment to the end of the input line
 const COMMENTCHAR = '#'
 
+// STATEMENTSEPARATOR separates the statements of a script, also on a single line
+const STATEMENTSEPARATOR = ';'
+
+// PIPECHAR separates the command from the filter stages of a pipeline
+const PIPECHAR = '|'
+
 // CHOICESTRING is used to mark a choice clause in the grammar
 const CHOICESTRING = "|"
 
+// LISTSTRING is the list operator, ITEM%SEP is a list of items separated by SEP,
+// ITEM%%SEP allows a trailing separator
+const LISTSTRING = "%"
+
+// PERMUTATIONSTRING is used to mark a set of clauses that may be given in any order
+const PERMUTATIONSTRING = "&"
+
+// errors reported by the tokenizer, wrapped in a TokenError
+var (
+	ErrNotAnInt               = errors.New("NOT_AN_INT")
+	ErrNotAFloat              = errors.New("NOT_A_FLOAT")
+	ErrCouldNotUnquote        = errors.New("COULD_NOT_UNQUOTE")
+	ErrUnterminatedString     = errors.New("UNTERMINATED_STRING")
+	ErrMissingSingleQuote     = errors.New("MISSING_SINGLE_QUOTE")
+	ErrUnterminatedExpression = errors.New("UNTERMINATED_EXPRESSION")
+)
+
 // TokenType for the cmdparser tokens
 type TokenType int
 
@@ -61,6 +103,9 @@ const (
 	TokenBool
 	TokenExpr
 	TokenERR
+	// added after TokenERR, so the values of the types above don't change
+	TokenFlag
+	TokenList
 )
 
 // PreToken is the struct that is the result from the internal Go scanner
@@ -76,6 +121,389 @@ type CmdToken struct {
 	Text     string
 	Value    interface{}
 	Position scanner.Position
+	End      scanner.Position
+}
+
+// Tokenizer converts an input line into the list of CmdParser tokens.
+// Implement this interface to plug a custom lexer into the grammar engine.
+type Tokenizer interface {
+	Tokenize(line string) ([]*CmdToken, error)
+}
+
+// ExprDelimiter is the pair of characters that enclose an expression token.
+// If Open and Close differ, the delimiters may be nested inside the expression.
+type ExprDelimiter struct {
+	Open  rune
+	Close rune
+}
+
+// DefaultTokenizer uses the internal scanner from Go to create the CmdParser tokens.
+// Delimiters lists the characters that start and end an expression, nil means
+// DefaultDelimiters and an empty slice turns expressions off. The quote
+// characters of Go strings can't be used.
+// BoolWords maps the lower case words that are read as booleans to their value,
+// nil means DefaultBoolWords and an empty map turns booleans off.
+type DefaultTokenizer struct {
+	Delimiters []ExprDelimiter
+	BoolWords  map[string]bool
+}
+
+// DefaultDelimiters are the expression delimiters of the DefaultTokenizer, the single quote
+var DefaultDelimiters = []ExprDelimiter{{Open: '\'', Close: '\''}}
+
+// DefaultBoolWords are the boolean words of the DefaultTokenizer
+var DefaultBoolWords = map[string]bool{"true": true, "yes": true, "false": false, "no": false}
+
+// TokenError is the error returned by the tokenizer and the alias expansion,
+// it holds the position and the original text of the offending token
+type TokenError struct {
+	Position scanner.Position
+	Text     string
+	Err      error
+}
+
+// Error to implement the error interface for the TokenError
+func (e *TokenError) Error() string {
+	return e.Err.Error() + " [" + e.Text + "] at col " + strconv.Itoa(e.Position.Column)
+}
+
+// Unwrap returns the underlying error, so errors.Is works with the Err* values
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// errors reported by the alias expansion, wrapped in a TokenError
+var (
+	ErrAliasRecursion       = errors.New("ALIAS_RECURSION")
+	ErrMissingAliasArgument = errors.New("MISSING_ALIAS_ARGUMENT")
+)
+
+// ErrInvalidAliasName is returned by Define for a name that is not an identifier
+var ErrInvalidAliasName = errors.New("INVALID_ALIAS_NAME")
+
+// AliasStore persists the alias definitions of an AliasTable
+type AliasStore interface {
+	Load() (map[string]string, error)
+	Save(aliases map[string]string) error
+}
+
+// FileAliasStore keeps the aliases in a text file, one `name = body` per line
+type FileAliasStore struct {
+	Path string
+}
+
+// AliasTable holds the aliases the users defined at run-time
+type AliasTable struct {
+	aliases map[string]string
+	store   AliasStore
+}
+
+// ErrUnknownVariable is reported for a variable reference that can't be resolved
+var ErrUnknownVariable = errors.New("UNKNOWN_VARIABLE")
+
+// VariableResolver looks up the values of the variables referenced in the input
+type VariableResolver interface {
+	Resolve(name string) (interface{}, bool)
+}
+
+// Variables is a VariableResolver for a simple map of variable values
+type Variables map[string]interface{}
+
+// ErrNoMatch is reported for a statement that does not match the grammar and
+// by RunPipeline after a Parse without a match
+var ErrNoMatch = errors.New("NO_MATCH")
+
+// ScriptError is the error for a statement of a script, it names the
+// script file and the position like a compiler would
+type ScriptError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+// Error to implement the error interface for the ScriptError
+func (e *ScriptError) Error() string {
+	return e.File + ":" + strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// StatementResult holds the outcome of parsing a single statement of a script
+type StatementResult struct {
+	File        string
+	Line        int
+	Column      int
+	Text        string
+	IsMatch     bool
+	ParseResult map[string]CmdToken
+	Err         error
+}
+
+// FilterFunc processes the output lines of a pipeline stage. args holds the parse
+// results of the stage. The function reads the lines from in and writes its lines
+// to out, out is closed by the dispatcher when the function returns.
+type FilterFunc func(args map[string]CmdToken, in <-chan string, out chan<- string) error
+
+// filterDef is a registered filter, its rule is named after the filter, see filterRule
+type filterDef struct {
+	name string
+	fn   FilterFunc
+}
+
+// PipelineStage is a parsed filter stage of a pipeline
+type PipelineStage struct {
+	Name        string
+	Position    scanner.Position
+	ParseResult map[string]CmdToken
+	fn          FilterFunc
+}
+
+// ErrInvalidGrammarLine is reported for a line of a grammar file that is not a rule
+var ErrInvalidGrammarLine = errors.New("INVALID_GRAMMAR_LINE")
+
+// ErrDuplicateRule is reported for a rule that is defined twice in a grammar
+// file and for a filter that is registered twice
+var ErrDuplicateRule = errors.New("DUPLICATE_RULE")
+
+// ErrMissingFilterFunc is returned by RegisterFilter for a filter without a function
+var ErrMissingFilterFunc = errors.New("MISSING_FILTER_FUNC")
+
+// errors reported by CompileGrammar, wrapped in a GrammarError
+var (
+	// ErrInvalidGrammarItem is reported for an item of a rule that can't be compiled
+	ErrInvalidGrammarItem = errors.New("INVALID_GRAMMAR_ITEM")
+	// ErrMissingRule is reported for a missing START rule and a call of an undefined rule
+	ErrMissingRule = errors.New("MISSING_RULE")
+	// ErrMixedOperators is reported for a rule with | and & at the top level
+	ErrMixedOperators = errors.New("MIXED_OPERATORS")
+)
+
+// GrammarError is the error for an item of a rule that can't be compiled, it
+// names the rule and the item as written in the grammar. Item is empty for a
+// missing rule.
+type GrammarError struct {
+	Rule string
+	Item string
+	Err  error
+}
+
+// Error to implement the error interface for the GrammarError
+func (e *GrammarError) Error() string {
+	if e.Item == "" {
+		return e.Err.Error() + " " + e.Rule
+	}
+	return e.Err.Error() + " [" + e.Item + "] in rule " + e.Rule
+}
+
+// Unwrap returns the underlying error
+func (e *GrammarError) Unwrap() error {
+	return e.Err
+}
+
+// the kinds of the issues reported by Lint
+const (
+	LintMissingRule  = "missing-rule"
+	LintUnreachable  = "unreachable"
+	LintShadowed     = "shadowed"
+	LintNullableLoop = "nullable-loop"
+	LintKeyword      = "keyword"
+	LintInvalidItem  = "invalid-item"
+)
+
+// LintIssue is a problem of a grammar found by Lint
+type LintIssue struct {
+	Rule    string
+	Kind    string
+	Message string
+}
+
+// String to implement Stringer interface for the LintIssue
+func (issue LintIssue) String() string {
+	return "Rule " + issue.Rule + ", " + issue.Message + " [" + issue.Kind + "]"
+}
+
+// ParseNode is a node of the parse tree, see ParseTree. Name is the rule of a
+// rule call or the item as it is written in the grammar, Key is the key of the
+// token in the ParseResult. The children of a rule call are its matched items.
+type ParseNode struct {
+	Name     string
+	Key      string
+	Token    *CmdToken
+	Children []*ParseNode
+	// group marks the node of a generated group rule, see String
+	group bool
+}
+
+// TraceEventType is the type of a TraceEvent
+type TraceEventType int
+
+// the events of the parser sent to a Tracer
+const (
+	TraceEnterRule TraceEventType = iota // the parser starts to match a rule
+	TraceExitRule                        // the rule is done, Match tells if it matched
+	TraceTryItem                         // the parser tries an item at a token
+	TraceMatch                           // the item matched the tokens from Pos to End
+	TraceFail                            // the item did not match at the token
+	TraceBacktrack                       // the parser returns to an earlier token
+	TraceInputLeft                       // START matched, but not all of the input
+)
+
+// TraceEvent describes a step of the parser. Item is the item as it is written
+// in the grammar, empty for the events of a rule. Pos is the index of the token
+// in the input, Token is nil at the end of the input. Depth is the number of
+// rules that are matched when the event happens. Index is the position of the
+// item in its rule, -1 for a separator and for the events of a rule.
+type TraceEvent struct {
+	Type  TraceEventType
+	Rule  string
+	Item  string
+	Index int
+	Token *CmdToken
+	Pos   int
+	End   int
+	Depth int
+	Match bool
+}
+
+// Tracer receives the events of the parser while it matches the input, see SetTracer
+type Tracer interface {
+	Trace(event TraceEvent)
+}
+
+// TracerFunc is a function that is used as a Tracer
+type TracerFunc func(event TraceEvent)
+
+// textTracer writes an indented line per event
+type textTracer struct {
+	w io.Writer
+}
+
+// jsonTracer writes a JSON object per event and line
+type jsonTracer struct {
+	encoder *json.Encoder
+}
+
+// jsonEvent is a TraceEvent in the JSON trace
+type jsonEvent struct {
+	Event  string `json:"event"`
+	Rule   string `json:"rule"`
+	Item   string `json:"item,omitempty"`
+	Token  string `json:"token,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Pos    int    `json:"pos"`
+	End    int    `json:"end,omitempty"`
+	Depth  int    `json:"depth"`
+	Match  bool   `json:"match,omitempty"`
+}
+
+// TraceNode is a step of a recorded trace. Event is the enter, try, backtrack
+// or input-left event of the step, its End and Match are set when the rule or
+// the item is done. The children of a rule are the items it tried, the child of
+// an item that calls a rule is the rule.
+type TraceNode struct {
+	Event    TraceEvent
+	Children []*TraceNode
+}
+
+// TraceRecorder is a Tracer that keeps the events of the parser as a tree of
+// steps, each match of START is a root
+type TraceRecorder struct {
+	Roots []*TraceNode
+	stack []*TraceNode
+}
+
+// TraceReport is the recorded trace and the parse tree of an input, see TraceInput
+type TraceReport struct {
+	Input string
+	Match bool
+	Trace []*TraceNode
+	Tree  *ParseNode
+	// tokens are the tokens of the input, the steps point into them
+	tokens []*CmdToken
+}
+
+// ErrNoInputGenerated is reported if the Generator could not find an input,
+// e.g. because a rule can't be matched without calling itself
+var ErrNoInputGenerated = errors.New("NO_INPUT_GENERATED")
+
+// Generator creates random inputs for the grammar of a parser, see NewGenerator.
+// Below MaxDepth rule calls it takes the shortest way to the end of the input,
+// items without an upper limit are repeated at most MaxRepeat times more than
+// they have to.
+type Generator struct {
+	MaxDepth  int
+	MaxRepeat int
+	parser    *CommandParser
+	random    *rand.Rand
+	// depths is the least number of rule calls needed to match each rule
+	depths map[string]int
+}
+
+// ItemCoverage counts how often an item of a rule was tried and matched
+type ItemCoverage struct {
+	Item    string `json:"item"`
+	Tries   int    `json:"tries"`
+	Matches int    `json:"matches"`
+}
+
+// RuleCoverage counts how often a rule was called and matched. The items of a
+// choice are its alternatives.
+type RuleCoverage struct {
+	Rule    string         `json:"rule"`
+	Choice  bool           `json:"choice,omitempty"`
+	Calls   int            `json:"calls"`
+	Matches int            `json:"matches"`
+	Items   []ItemCoverage `json:"items"`
+}
+
+// Coverage is a Tracer that counts which rules and items the parses of a
+// parser matched, see NewCoverage. A rule or an item is covered if it
+// matched at least once.
+type Coverage struct {
+	Rules []*RuleCoverage
+	rules map[string]*RuleCoverage
+}
+
+// capture is an entry of the log of the tokens captured by the rule items.
+// The children entries before a rule call or a list belong to it.
+type capture struct {
+	item     *RuleItem
+	tok      *CmdToken
+	children int
+	// scope is the rule of a captured flag
+	scope *flagScope
+}
+
+// memoKey identifies the match of a rule at a position of the input
+type memoKey struct {
+	rule *RuleStruct
+	pos  int
+}
+
+// memoEntry is the memoized result of a rule at a position of the input
+type memoEntry struct {
+	match    bool
+	end      int
+	captures []capture
+	errors   []*ParseError
+}
+
+// growState is the seed of a left recursive rule that is matched at a position
+type growState struct {
+	seed     *memoEntry
+	detected bool
+}
+
+// flagScope holds the flags of a rule that is currently matched. The flags
+// given are the captures since start, so backtracking forgets them, too.
+type flagScope struct {
+	rule  *RuleStruct
+	start int
 }
 
 // ParseError ist the structure plannes for more verbose parser messages
@@ -96,6 +524,10 @@ func (tok CmdToken) String() string {
 		s += "ERR "
 	case TokenExpr:
 		s += "Expression "
+	case TokenFlag:
+		s += "Flag "
+	case TokenList:
+		s += "List "
 	case TokenFloat:
 		s += "Float "
 	case TokenIdent:
@@ -112,12 +544,19 @@ func (tok CmdToken) String() string {
 
 // RuleItem ist the struct that holds a single grammar rule item
 type RuleItem struct {
-	ParentRule  *RuleStruct
-	Cardinality GrammarItemCardinality
-	ExprType    GrammarItemType
-	ExprString  string
-	TokenPtr    *CmdToken
-	Seen        bool
+	ParentRule        *RuleStruct
+	Cardinality       GrammarItemCardinality
+	ExprType          GrammarItemType
+	ExprString        string
+	FlagValue         string
+	MinOccur          int
+	MaxOccur          int
+	Separator         *RuleItem
+	TrailingSeparator bool
+	TokenPtr          *CmdToken
+	Seen              bool
+	regex             *regexp.Regexp
+	invalid           *GrammarError
 }
 
 // String to implement Stringer interface for the RuleItem
@@ -134,6 +573,12 @@ func (item RuleItem) String() string {
 		s += "DataTypeExpr"
 	case IdentifierExpr:
 		s += "IdentifierExpr"
+	case FlagExpr:
+		s += "FlagExpr"
+	case PredicateExpr:
+		s += "PredicateExpr"
+	case NotPredicateExpr:
+		s += "NotPredicateExpr"
 	}
 	s += " Expression: [" + item.ExprString + "]"
 	switch item.Cardinality {
@@ -155,6 +600,10 @@ type RuleStruct struct {
 	Type  GrammarItemType
 	Items []*RuleItem
 	seen  bool
+	// invalid is the error of a rule that can't be compiled, it never matches
+	invalid *GrammarError
+	// leftRecursive marks the rules of a left recursive cycle, see LeftRecursion
+	leftRecursive bool
 }
 
 // CommandParser is the main container for run-time information of the parser
@@ -165,8 +614,26 @@ type CommandParser struct {
 	options        uint64
 	inputLine      string
 	tokenList      []*CmdToken
+	tokens         []*CmdToken
+	tokenPos       int
+	captures       []capture
+	memo           map[memoKey]*memoEntry
+	growing        map[memoKey]*growState
+	tracer         Tracer
+	traceDepth     int
 	errorList      []*ParseError
 	rules          map[string]*RuleStruct
 	grammar        map[string]string
+	tokenizer      Tokenizer
+	tokenizerErr   error
+	filters        map[string]*filterDef
+	aliases        *AliasTable
+	variables      VariableResolver
+	reserved       map[string]bool
+	keywords       map[string]bool
+	usesFlags      bool
+	argsMode       bool
+	flagScopes     []*flagScope
+	Stages         []*PipelineStage
 	ParseResult    map[string]CmdToken
 }
@@ -0,0 +1,122 @@
+package cmdparser
+
+import "strings"
+
+// maxSynopsisDepth limits how deep the rules are written out in a synopsis
+const maxSynopsisDepth = 8
+
+// Synopsis describes the input the grammar accepts, like the synopsis of a man
+// page. Each alternative of START is a line, the rules it calls are written
+// out. Optional parts are in brackets, "..." marks a repetition and data types
+// are written in upper case. Items that may be given in any order are written
+// in braces and separated by &. A rule that calls itself is written by its name.
+func (theParser *CommandParser) Synopsis() []string {
+	rule, ok := theParser.rules["START"]
+	if !ok {
+		return nil
+	}
+	// follow the rules that only call another rule, like START: `Command`
+	for len(rule.Items) == 1 && rule.Type == Sequence {
+		item := rule.Items[0]
+		next, ok := theParser.rules[item.ExprString]
+		if !ok || item.ExprType != SymbolExpr || item.MinOccur != 1 || item.MaxOccur != 1 || item.Separator != nil {
+			break
+		}
+		rule = next
+	}
+	path := map[string]bool{"START": true, rule.Name: true}
+	if rule.Type != Choice {
+		return []string{theParser.synopsisRule(rule, path, 0)}
+	}
+	lines := []string{}
+	for _, item := range rule.Items {
+		lines = append(lines, theParser.synopsisItem(item, path, 0, true))
+	}
+	return lines
+}
+
+// synopsisRule writes out the items of a rule. path holds the rules that are
+// written out above the rule.
+func (theParser *CommandParser) synopsisRule(rule *RuleStruct, path map[string]bool, depth int) string {
+	operator := " "
+	switch rule.Type {
+	case Choice:
+		operator = " " + CHOICESTRING + " "
+	case Permutation:
+		operator = " " + PERMUTATIONSTRING + " "
+	}
+	parts := []string{}
+	for _, item := range rule.Items {
+		if s := theParser.synopsisItem(item, path, depth, rule.Type != Sequence); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if rule.Type == Permutation && len(parts) > 1 {
+		return "{" + strings.Join(parts, operator) + "}"
+	}
+	return strings.Join(parts, operator)
+}
+
+// synopsisItem writes out an item with its number of occurrences. An
+// alternative of a choice is written without parentheses.
+func (theParser *CommandParser) synopsisItem(item *RuleItem, path map[string]bool, depth int, alternative bool) string {
+	s := ""
+	choice := false
+	switch item.ExprType {
+	case IdentifierExpr, CharExpr:
+		s = item.ExprString
+	case DataTypeExpr:
+		s = strings.ToUpper(item.ExprString)
+	case ClassExpr:
+		s = "<" + item.ExprString + ">"
+	case FlagExpr:
+		s = item.ExprString
+		if item.FlagValue != "" {
+			s += "=" + strings.ToUpper(item.FlagValue)
+		}
+	case PredicateExpr, NotPredicateExpr:
+		// predicates don't consume input
+		return ""
+	case SymbolExpr:
+		rule, ok := theParser.rules[item.ExprString]
+		if !ok || path[rule.Name] || depth >= maxSynopsisDepth {
+			s = item.ExprString
+			break
+		}
+		path[rule.Name] = true
+		s = theParser.synopsisRule(rule, path, depth+1)
+		delete(path, rule.Name)
+		choice = rule.Type == Choice && len(rule.Items) > 1
+	}
+	if item.Separator != nil {
+		sep := item.Separator.ExprString
+		if item.Separator.ExprType != CharExpr {
+			sep = " " + sep
+		}
+		if choice {
+			s = "(" + s + ")"
+		}
+		s += "[" + sep + " " + s + "]..."
+		if item.MinOccur == 0 {
+			s = "[" + s + "]"
+		}
+		return s
+	}
+	min, max := item.MinOccur, item.MaxOccur
+	switch {
+	case min == 0 && max == 1:
+		return "[" + s + "]"
+	case min == 0 && max == Unbounded:
+		return "[" + s + "]..."
+	}
+	if choice && (!alternative || min != 1 || max != 1) {
+		s = "(" + s + ")"
+	}
+	switch {
+	case min == 1 && max == 1:
+		return s
+	case min == 1 && max == Unbounded:
+		return s + "..."
+	}
+	return s + occurrence(min, max)
+}
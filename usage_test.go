@@ -0,0 +1,33 @@
+package cmdparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSynopsis(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(commandGrammar)
+	synopsis := p.Synopsis()
+	Assert(t, len(synopsis) == 50, "Expected a line for each command")
+	Assert(t, synopsis[0] == `show feature [STRING] [lang STRING[, STRING]...] [to STRING]`, "Unexpected synopsis "+synopsis[0])
+	Assert(t, synopsis[30] == `select (* | IDENT[, IDENT]...) from IDENT [where EXPRESSION] [order by IDENT [asc | desc]] [limit INT]`, "Unexpected synopsis "+synopsis[30])
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": `"copy" -v? --count=!int? &("x") [a-z]{2,3} !string+ Expr`,
+		"Expr":  `Expr '+' !int | !int`,
+	})
+	expected := []string{`copy [-v] [--count=INT] <[a-z]>{2,3} STRING... (Expr + INT | INT)`}
+	Assert(t, reflect.DeepEqual(p.Synopsis(), expected), "Unexpected synopsis "+p.Synopsis()[0])
+
+	p = NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START":   `"list" Options`,
+		"Options": `Limit? & Sort & "verbose"?`,
+		"Limit":   `"limit" !int`,
+		"Sort":    `"sort" !ident`,
+	})
+	expected = []string{`list {[limit INT] & sort IDENT & [verbose]}`}
+	Assert(t, reflect.DeepEqual(p.Synopsis(), expected), "Unexpected synopsis "+p.Synopsis()[0])
+}
@@ -0,0 +1,177 @@
+package cmdparser
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ENVPREFIX marks a variable reference that is resolved from the environment, as in ${env:HOME}
+const ENVPREFIX = "env:"
+
+// Resolve to implement the VariableResolver interface for Variables
+func (vars Variables) Resolve(name string) (interface{}, bool) {
+	val, ok := vars[name]
+	return val, ok
+}
+
+// SetVariables sets the resolver for the $name, ${name} and ${env:NAME}
+// references in the input. References are only replaced with a resolver, use
+// an empty Variables for ${env:NAME} alone. Passing nil or setting
+// OptionNoInterpolation turns this off.
+func (theParser *CommandParser) SetVariables(resolver VariableResolver) {
+	theParser.variables = resolver
+}
+
+// lookupVariable resolves a variable name, names with ENVPREFIX are taken from the environment
+func (theParser *CommandParser) lookupVariable(name string) (interface{}, bool) {
+	if strings.HasPrefix(name, ENVPREFIX) {
+		return os.LookupEnv(name[len(ENVPREFIX):])
+	}
+	if theParser.variables == nil {
+		return nil, false
+	}
+	return theParser.variables.Resolve(name)
+}
+
+// adjacent reports if the token b directly follows the token a in the input
+func adjacent(a, b *CmdToken) bool {
+	return b.Position.Line == a.Position.Line && b.Position.Offset == a.Position.Offset+len(a.Text)
+}
+
+// interpolate replaces the variable references in the token list with tokens
+// of the type of their value, so an int variable matches !int. References in
+// double quoted strings are replaced by the text of the value. Without a
+// resolver the tokens are left as they are.
+func (theParser *CommandParser) interpolate(line string, tokens []*CmdToken) ([]*CmdToken, error) {
+	if theParser.variables == nil || theParser.options&OptionNoInterpolation != 0 {
+		return tokens, nil
+	}
+	result := []*CmdToken{}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Type == TokenString && strings.HasPrefix(tok.Text, `"`) {
+			s, err := theParser.interpolateString(tok, tok.Value.(string))
+			if err != nil {
+				return nil, err
+			}
+			if s != tok.Value {
+				// the text is the interpolated string, like the text of a variable token
+				tok = copyToken(tok)
+				tok.Value = s
+				tok.Text = strconv.Quote(s)
+			}
+		}
+		if tok.Type != TokenChar || tok.Text != "$" || i+1 >= len(tokens) || !adjacent(tok, tokens[i+1]) {
+			result = append(result, tok)
+			continue
+		}
+		// find the name and the last token of the reference
+		name, last := "", i+1
+		next := tokens[i+1]
+		switch {
+		case next.Type == TokenIdent:
+			name = next.Text
+		case next.Type == TokenBool && next.End.Offset > next.Position.Offset && next.End.Offset <= len(line):
+			// the text of yes, no, true and false is lower case
+			name = line[next.Position.Offset:next.End.Offset]
+		case next.Type == TokenExpr && next.Position.Offset < len(line) && line[next.Position.Offset] == '{':
+			// braces are configured as expression delimiters
+			name = strings.TrimSpace(next.Text)
+		case next.Type == TokenChar && next.Text == "{":
+			for last < len(tokens) && !(tokens[last].Type == TokenChar && tokens[last].Text == "}") {
+				last++
+			}
+			if last >= len(tokens) {
+				return nil, &TokenError{Position: tok.Position, Text: "${", Err: ErrUnknownVariable}
+			}
+			if tokens[last].Position.Offset <= len(line) {
+				name = strings.TrimSpace(line[next.Position.Offset+1 : tokens[last].Position.Offset])
+			}
+		default:
+			// not a reference, like $1 in the body of an alias
+			result = append(result, tok)
+			continue
+		}
+		val, ok := theParser.lookupVariable(name)
+		if !ok {
+			return nil, &TokenError{Position: tok.Position, Text: "$" + name, Err: ErrUnknownVariable}
+		}
+		varTok := tokenFromValue(val)
+		varTok.Position = tok.Position
+		varTok.End = tokens[last].End
+		result = append(result, varTok)
+		i = last
+	}
+	return result, nil
+}
+
+// interpolateString replaces $name and ${name} in the value of a string token, $$ is a $
+func (theParser *CommandParser) interpolateString(tok *CmdToken, s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		name := ""
+		switch {
+		case s[i+1] == '$':
+			sb.WriteByte('$')
+			i++
+			continue
+		case s[i+1] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return s, &TokenError{Position: tok.Position, Text: tok.Text, Err: ErrUnknownVariable}
+			}
+			name = strings.TrimSpace(s[i+2 : i+end])
+			i += end
+		default:
+			end := i + 1
+			for end < len(s) {
+				r, size := utf8.DecodeRuneInString(s[end:])
+				if r != '_' && !unicode.IsLetter(r) && !(unicode.IsDigit(r) && end > i+1) {
+					break
+				}
+				end += size
+			}
+			if end == i+1 {
+				sb.WriteByte('$')
+				continue
+			}
+			name = s[i+1 : end]
+			i = end - 1
+		}
+		val, ok := theParser.lookupVariable(name)
+		if !ok {
+			return s, &TokenError{Position: tok.Position, Text: "$" + name, Err: ErrUnknownVariable}
+		}
+		sb.WriteString(fmt.Sprint(val))
+	}
+	return sb.String(), nil
+}
+
+// tokenFromValue creates the token for the value of a variable
+func tokenFromValue(val interface{}) *CmdToken {
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &CmdToken{Type: TokenInt, Text: strconv.FormatInt(rv.Int(), 10), Value: int(rv.Int())}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &CmdToken{Type: TokenInt, Text: strconv.FormatUint(rv.Uint(), 10), Value: int(rv.Uint())}
+	case reflect.Float32, reflect.Float64:
+		return &CmdToken{Type: TokenFloat, Text: strconv.FormatFloat(rv.Float(), 'g', -1, 64), Value: rv.Float()}
+	case reflect.Bool:
+		return &CmdToken{Type: TokenBool, Text: strconv.FormatBool(rv.Bool()), Value: rv.Bool()}
+	}
+	s := fmt.Sprint(val)
+	return &CmdToken{Type: TokenString, Text: strconv.Quote(s), Value: s}
+}
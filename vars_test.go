@@ -0,0 +1,68 @@
+package cmdparser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInterpolation(t *testing.T) {
+	t.Setenv("CMDPARSER_TEST_DIR", "/tmp/export")
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "show" "feature" !string "limit" !int "to" !string `,
+	})
+	p.SetVariables(Variables{"lang": "de", "max": int64(10), "No": "x"})
+
+	err := p.SetInputString(`show feature $lang limit ${max} to "${env:CMDPARSER_TEST_DIR}/$lang.csv"`)
+	Assert(t, err == nil, "Unexpected interpolation error")
+	Assert(t, p.Parse(), "Should match input string, but does not!")
+	Assert(t, p.ParseResult["start_string"].Value == "/tmp/export/de.csv", "Variables in strings not replaced")
+	Assert(t, p.ParseResult["start_string"].Text == `"/tmp/export/de.csv"`, "Expected the interpolated text")
+	Assert(t, p.ParseResult["start_int"].Value == 10, "Int variable must be an int token")
+	Assert(t, p.ParseResult["start_int"].Position.Column == 26, "Variable token must keep the position of the reference")
+
+	err = p.SetInputString(`show feature $No limit 1 to "price: $$5"`)
+	Assert(t, err == nil && p.Parse(), "Should match input string, but does not!")
+	Assert(t, p.ParseResult["start_string"].Value == "price: $5", "$$ must be replaced by $")
+
+	err = p.SetInputString(`show feature $unknown limit 1 to "x"`)
+	var tokErr *TokenError
+	Assert(t, errors.As(err, &tokErr) && errors.Is(err, ErrUnknownVariable), "Expected unknown variable error")
+	Assert(t, tokErr != nil && tokErr.Position.Column == 14, "Wrong position for unknown variable")
+
+	p.SetOptions(OptionNoInterpolation)
+	err = p.SetInputString(`show feature $lang limit 1 to "$lang"`)
+	Assert(t, err == nil && len(p.tokenList) == 8, "Interpolation must be disabled")
+	Assert(t, !p.Parse(), "Without interpolation $lang is not a string")
+}
+
+func TestNoInterpolationWithoutVariables(t *testing.T) {
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "echo" !string `,
+	})
+	err := p.SetInputString(`echo "costs $HOME"`)
+	Assert(t, err == nil && p.Parse(), "Expected no interpolation without variables")
+	Assert(t, p.ParseResult["start_string"].Value == "costs $HOME", "Expected the string as it is")
+
+	p.SetVariables(Variables{})
+	err = p.SetInputString(`echo "costs $HOME"`)
+	Assert(t, errors.Is(err, ErrUnknownVariable), "Expected interpolation with variables")
+	p.SetVariables(nil)
+	err = p.SetInputString(`echo "costs $HOME"`)
+	Assert(t, err == nil, "Expected no interpolation after removing the variables")
+}
+
+func TestInterpolationInAlias(t *testing.T) {
+	aliases, _ := NewAliasTable(nil)
+	aliases.Define("sl", `show feature $lang limit $1 to $out`)
+	p := NewParser()
+	p.SetCommandGrammar(map[string]string{
+		"START": ` "show" "feature" !string "limit" !int "to" !string `,
+	})
+	p.SetAliases(aliases)
+	p.SetVariables(Variables{"lang": "it", "out": "/tmp/it.csv", "n": 5})
+	err := p.SetInputString(`sl $n`)
+	Assert(t, err == nil && p.Parse(), "Should match expanded alias, but does not!")
+	Assert(t, p.ParseResult["start_int"].Value == 5, "Variable as alias argument not replaced")
+}